@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/LoCCS/lmots"
+	"github.com/LoCCS/lms"
+	"github.com/LoCCS/lms/internal/atomicfile"
+)
+
+// newFlagSet makes a flag set of the subcommand reporting to stderr
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("lms "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// fail reports the error and returns the exit code of failures
+func fail(stderr io.Writer, err error) int {
+	fmt.Fprintf(stderr, "lms: %v\n", err)
+	return 1
+}
+
+func keygen(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("keygen", stderr)
+	out := fs.String("out", "", "prefix of the key files to write")
+	typ := fs.String("type", "LMS_SHA256_M32_H10", "name of the LMS parameter set")
+	height := fs.Uint("height", 0, "height of a fully kept SHA3-256 tree, overriding -type")
+	bounded := fs.Bool("bounded", false, "derive leaves on demand to bound the state size")
+	passfile := fs.String("passfile", "", "file holding the passphrase")
+	if err := fs.Parse(args); nil != err {
+		return 2
+	}
+	if "" == *out {
+		fmt.Fprintln(stderr, "lms keygen: -out is required")
+		return 2
+	}
+	if (*height > 0) && *bounded {
+		fmt.Fprintln(stderr, "lms keygen: -bounded applies to -type only")
+		return 2
+	}
+
+	for _, path := range []string{*out + pubSuffix, *out + agentSuffix, *out + idxSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			return fail(stderr, fmt.Errorf("%s exists", path))
+		}
+	}
+
+	passphrase, err := readPassphrase(*passfile)
+	if nil != err {
+		return fail(stderr, err)
+	}
+
+	seed := make([]byte, lmots.N)
+	if _, err := io.ReadFull(rand.Reader, seed); nil != err {
+		return fail(stderr, err)
+	}
+
+	var agent *lms.MerkleAgent
+	if *height > 0 {
+		agent, err = lms.NewMerkleAgent(uint32(*height), seed)
+	} else {
+		var ps *lms.ParamSet
+		if ps, err = lms.LookupParamSetByName(*typ); nil == err {
+			agent, err = lms.NewMerkleAgentWithOptions(seed,
+				&lms.AgentOpts{Typecode: ps.Typecode, Bounded: *bounded})
+		}
+	}
+	for i := range seed {
+		seed[i] = 0
+	}
+	if nil != err {
+		return fail(stderr, err)
+	}
+	defer agent.Close()
+
+	pkData, err := agent.PublicKey().MarshalBinary()
+	if nil != err {
+		return fail(stderr, err)
+	}
+
+	if err := agent.SetStateStore(lms.NewFileStateStore(*out + idxSuffix)); nil != err {
+		return fail(stderr, err)
+	}
+	if err := saveAgent(*out, agent, passphrase); nil != err {
+		return fail(stderr, err)
+	}
+	if err := atomicfile.WriteFile(*out+pubSuffix, pkData); nil != err {
+		return fail(stderr, err)
+	}
+
+	fmt.Fprintf(stdout, "%s\n", hex.EncodeToString(pkData))
+
+	return 0
+}
+
+func sign(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("sign", stderr)
+	key := fs.String("key", "", "prefix of the key files")
+	in := fs.String("in", "", "file to sign, or - for stdin")
+	out := fs.String("out", "", "file to write the detached signature")
+	passfile := fs.String("passfile", "", "file holding the passphrase")
+	if err := fs.Parse(args); nil != err {
+		return 2
+	}
+	if ("" == *key) || ("" == *in) || ("" == *out) {
+		fmt.Fprintln(stderr, "lms sign: -key, -in and -out are required")
+		return 2
+	}
+
+	passphrase, err := readPassphrase(*passfile)
+	if nil != err {
+		return fail(stderr, err)
+	}
+
+	agent, err := loadAgent(*key, passphrase)
+	if nil != err {
+		return fail(stderr, err)
+	}
+	defer agent.Close()
+
+	r, err := openInput(*in)
+	if nil != err {
+		return fail(stderr, err)
+	}
+	defer r.Close()
+
+	// the leaf is reserved in the index file before signing
+	sig, err := agent.SignReader(r)
+	if nil != err {
+		return fail(stderr, err)
+	}
+	sigData, err := sig.MarshalBinary()
+	if nil != err {
+		return fail(stderr, err)
+	}
+
+	// the state is updated before the signature is released
+	if err := saveAgent(*key, agent, passphrase); nil != err {
+		return fail(stderr, err)
+	}
+	if err := atomicfile.WriteFile(*out, sigData); nil != err {
+		return fail(stderr, err)
+	}
+
+	return 0
+}
+
+func verify(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("verify", stderr)
+	pub := fs.String("pub", "", "file of the public key")
+	in := fs.String("in", "", "signed file, or - for stdin")
+	sigPath := fs.String("sig", "", "file of the detached signature")
+	if err := fs.Parse(args); nil != err {
+		return 2
+	}
+	if ("" == *pub) || ("" == *in) || ("" == *sigPath) {
+		fmt.Fprintln(stderr, "lms verify: -pub, -in and -sig are required")
+		return 2
+	}
+
+	pk, err := readPublicKey(*pub)
+	if nil != err {
+		return fail(stderr, err)
+	}
+
+	sigData, err := ioutil.ReadFile(*sigPath)
+	if nil != err {
+		return fail(stderr, err)
+	}
+	sig := new(lms.MerkleSig)
+	if err := sig.UnmarshalBinary(sigData); nil != err {
+		return fail(stderr, err)
+	}
+
+	r, err := openInput(*in)
+	if nil != err {
+		return fail(stderr, err)
+	}
+	defer r.Close()
+
+	ok, err := pk.VerifyReader(r, sig)
+	if nil != err {
+		return fail(stderr, err)
+	}
+	if !ok {
+		return fail(stderr, fmt.Errorf("signature verification failed"))
+	}
+
+	fmt.Fprintln(stdout, "OK")
+
+	return 0
+}
+
+func pubkey(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("pubkey", stderr)
+	key := fs.String("key", "", "prefix of the key files")
+	out := fs.String("out", "", "file to write the public key, which is printed in hex if empty")
+	if err := fs.Parse(args); nil != err {
+		return 2
+	}
+	if "" == *key {
+		fmt.Fprintln(stderr, "lms pubkey: -key is required")
+		return 2
+	}
+
+	pk, err := loadPublicKey(*key)
+	if nil != err {
+		return fail(stderr, err)
+	}
+	pkData, err := pk.MarshalBinary()
+	if nil != err {
+		return fail(stderr, err)
+	}
+
+	if "" == *out {
+		fmt.Fprintf(stdout, "%s\n", hex.EncodeToString(pkData))
+		return 0
+	}
+	if err := atomicfile.WriteFile(*out, pkData); nil != err {
+		return fail(stderr, err)
+	}
+
+	return 0
+}
+
+func status(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("status", stderr)
+	key := fs.String("key", "", "prefix of the key files")
+	if err := fs.Parse(args); nil != err {
+		return 2
+	}
+	if "" == *key {
+		fmt.Fprintln(stderr, "lms status: -key is required")
+		return 2
+	}
+
+	pk, err := loadPublicKey(*key)
+	if nil != err {
+		return fail(stderr, err)
+	}
+	ps, err := lms.LookupParamSet(pk.Typecode)
+	if nil != err {
+		return fail(stderr, err)
+	}
+
+	// leaves reserved in the index file count as used, since they
+	// are burnt on the next signing
+	state, err := lms.NewFileStateStore(*key + idxSuffix).Load()
+	if nil != err {
+		return fail(stderr, err)
+	}
+	if nil == state {
+		return fail(stderr, fmt.Errorf("%s is missing", *key+idxSuffix))
+	}
+	if !bytes.Equal(state.I, pk.I) {
+		return fail(stderr, lms.ErrStateMismatch)
+	}
+
+	total := uint64(1) << pk.Height
+	next := uint64(state.Next)
+	if next > total {
+		next = total
+	}
+
+	fmt.Fprintf(stdout, "parameter set: %s\n", ps.Name)
+	fmt.Fprintf(stdout, "height:        %d\n", pk.Height)
+	fmt.Fprintf(stdout, "leaf index:    %d\n", next)
+	fmt.Fprintf(stdout, "remaining:     %d of %d\n", total-next, total)
+	fmt.Fprintf(stdout, "exhausted:     %v\n", next == total)
+
+	return 0
+}
+
+// openInput opens the file of path, or stdin for "-"
+func openInput(path string) (io.ReadCloser, error) {
+	if "-" == path {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+
+	return os.Open(path)
+}
+
+// readPublicKey reads the RFC 8554 public key from the file of path
+func readPublicKey(path string) (*lms.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		return nil, err
+	}
+
+	pk := new(lms.PublicKey)
+	if err := pk.UnmarshalBinary(data); nil != err {
+		return nil, err
+	}
+
+	return pk, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/LoCCS/lms"
+)
+
+// inspection is the JSON printed by inspect, naming the detected type
+// and encoding of the blob
+type inspection struct {
+	Type     string      `json:"type"`
+	Encoding string      `json:"encoding"`
+	Value    interface{} `json:"value"`
+}
+
+// detectors try to decode blobs in order, where the gob decoders
+// reject blobs of other gob types by their field names
+var detectors = []func(data []byte) (*inspection, error){
+	inspectAgentFile,
+	inspectAgentState,
+	inspectPEMPublicKey,
+	inspectPKIXPublicKey,
+	inspectPublicKey,
+	inspectSig,
+	inspectGobSig,
+}
+
+func inspect(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("inspect", stderr)
+	in := fs.String("in", "", "file to inspect, or - for stdin")
+	if err := fs.Parse(args); nil != err {
+		return 2
+	}
+	if "" == *in {
+		fmt.Fprintln(stderr, "lms inspect: -in is required")
+		return 2
+	}
+
+	r, err := openInput(*in)
+	if nil != err {
+		return fail(stderr, err)
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if nil != err {
+		return fail(stderr, err)
+	}
+
+	for _, detect := range detectors {
+		result, err := detect(data)
+		if nil != err {
+			continue
+		}
+
+		out, err := json.MarshalIndent(result, "", "  ")
+		if nil != err {
+			return fail(stderr, err)
+		}
+		fmt.Fprintf(stdout, "%s\n", out)
+
+		return 0
+	}
+
+	return fail(stderr, fmt.Errorf("unrecognized blob of %d bytes", len(data)))
+}
+
+// inspectAgentFile decodes the agent file written by keygen and sign,
+// whose secret data is left encrypted
+func inspectAgentFile(data []byte) (*inspection, error) {
+	file := new(agentFile)
+	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(file); nil != err {
+		return nil, err
+	}
+
+	view, err := lms.ParseAgentView(file.Public)
+	if nil != err {
+		return nil, err
+	}
+
+	return &inspection{"agent", "agent file", view}, nil
+}
+
+// inspectAgentState decodes the public data of agents given by Serialize
+func inspectAgentState(data []byte) (*inspection, error) {
+	view, err := lms.ParseAgentView(data)
+	if nil != err {
+		return nil, err
+	}
+
+	return &inspection{"agent", "gob", view}, nil
+}
+
+// inspectPublicKey decodes the RFC 8554 encoded public key
+func inspectPublicKey(data []byte) (*inspection, error) {
+	pk := new(lms.PublicKey)
+	if err := pk.UnmarshalBinary(data); nil != err {
+		return nil, err
+	}
+
+	return &inspection{"public key", "rfc8554", pk}, nil
+}
+
+// inspectPEMPublicKey decodes the public key in a PEM block
+func inspectPEMPublicKey(data []byte) (*inspection, error) {
+	pk, err := lms.ParsePublicKeyPEM(data)
+	if nil != err {
+		return nil, err
+	}
+
+	return &inspection{"public key", "pem", pk}, nil
+}
+
+// inspectPKIXPublicKey decodes the public key in a DER-encoded
+// SubjectPublicKeyInfo
+func inspectPKIXPublicKey(data []byte) (*inspection, error) {
+	pk, err := lms.ParsePKIXPublicKey(data)
+	if nil != err {
+		return nil, err
+	}
+
+	return &inspection{"public key", "pkix", pk}, nil
+}
+
+// inspectSig decodes the RFC 8554 encoded signature
+func inspectSig(data []byte) (*inspection, error) {
+	sig := new(lms.MerkleSig)
+	if err := sig.UnmarshalBinary(data); nil != err {
+		return nil, err
+	}
+
+	return &inspection{"signature", "rfc8554", sig}, nil
+}
+
+// inspectGobSig decodes the signature given by MerkleSig.Serialize
+func inspectGobSig(data []byte) (*inspection, error) {
+	sig := new(lms.MerkleSig)
+	if err := sig.Deserialize(data); nil != err {
+		return nil, err
+	}
+
+	return &inspection{"signature", "gob", sig}, nil
+}
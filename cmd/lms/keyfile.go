@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/LoCCS/lms"
+	"github.com/LoCCS/lms/internal/atomicfile"
+)
+
+// suffixes of the key files under a prefix
+const (
+	pubSuffix   = ".pub"
+	agentSuffix = ".lms"
+	idxSuffix   = ".idx"
+)
+
+// errPublicKeyMismatch is returned if the public key kept in the
+// agent file isn't the one of the decrypted agent
+var errPublicKeyMismatch = errors.New("public key mismatches the agent")
+
+// passphraseEnv is the environment variable holding the passphrase
+// if no passphrase file is given
+const passphraseEnv = "LMS_PASSPHRASE"
+
+// agentFile is the content of NAME.lms, which keeps the public tree
+// data and the envelope authenticating it together, so that both
+// are replaced at once. The RFC 8554 public key is kept in the clear
+// for reading without the passphrase
+type agentFile struct {
+	PublicKey []byte
+	Public    []byte
+	Envelope  []byte
+}
+
+// readPassphrase reads the passphrase from the file of path, where
+// the trailing newline is dropped, or from the environment
+func readPassphrase(path string) ([]byte, error) {
+	if "" == path {
+		passphrase := os.Getenv(passphraseEnv)
+		if "" == passphrase {
+			return nil, errors.New("no passphrase: use -passfile or set " + passphraseEnv)
+		}
+		return []byte(passphrase), nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		return nil, err
+	}
+
+	return []byte(strings.TrimRight(string(data), "\r\n")), nil
+}
+
+// loadAgent decrypts the agent of the prefix, which is then bound to
+// the index file so that leaves used by signatures whose state
+// failed to be saved are skipped
+func loadAgent(prefix string, passphrase []byte) (*lms.MerkleAgent, error) {
+	file, err := readAgentFile(prefix)
+	if nil != err {
+		return nil, err
+	}
+
+	agent := new(lms.MerkleAgent)
+	if err := agent.ImportEncryptedSecretKey(file.Public, file.Envelope, passphrase); nil != err {
+		return nil, err
+	}
+
+	// the public key in the clear is not covered by the envelope
+	pkData, err := agent.PublicKey().MarshalBinary()
+	if nil != err {
+		agent.Close()
+		return nil, err
+	}
+	if !bytes.Equal(pkData, file.PublicKey) {
+		agent.Close()
+		return nil, errPublicKeyMismatch
+	}
+
+	if err := agent.SetStateStore(lms.NewFileStateStore(prefix + idxSuffix)); nil != err {
+		agent.Close()
+		return nil, err
+	}
+
+	return agent, nil
+}
+
+// loadPublicKey reads the public key of the prefix from the agent
+// file, for which no passphrase is needed
+func loadPublicKey(prefix string) (*lms.PublicKey, error) {
+	file, err := readAgentFile(prefix)
+	if nil != err {
+		return nil, err
+	}
+
+	pk := new(lms.PublicKey)
+	if err := pk.UnmarshalBinary(file.PublicKey); nil != err {
+		return nil, err
+	}
+
+	return pk, nil
+}
+
+// readAgentFile decodes the agent file of the prefix
+func readAgentFile(prefix string) (*agentFile, error) {
+	data, err := ioutil.ReadFile(prefix + agentSuffix)
+	if nil != err {
+		return nil, err
+	}
+
+	file := new(agentFile)
+	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(file); nil != err {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// saveAgent encrypts the agent under the passphrase, and replaces the
+// agent file of the prefix atomically
+func saveAgent(prefix string, agent *lms.MerkleAgent, passphrase []byte) error {
+	pkData, err := agent.PublicKey().MarshalBinary()
+	if nil != err {
+		return err
+	}
+	public, envelope, err := agent.ExportEncryptedSecretKey(passphrase)
+	if nil != err {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(&agentFile{pkData, public, envelope}); nil != err {
+		return err
+	}
+
+	return atomicfile.WriteFile(prefix+agentSuffix, buf.Bytes())
+}
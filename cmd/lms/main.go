@@ -0,0 +1,71 @@
+// Command lms generates LMS keys, signs files and verifies signatures.
+//
+// A key generated under the prefix NAME is kept in three files:
+//
+//	NAME.pub  the public key encoded according to RFC 8554
+//	NAME.lms  the public tree data and the secret data encrypted under a passphrase
+//	NAME.idx  the index of the next leaf, which is reserved before each signature
+//
+// The passphrase needed by keygen and sign is read from the file given
+// by -passfile, or from the environment variable LMS_PASSPHRASE, while
+// pubkey and status read only the public part of NAME.lms and NAME.idx.
+//
+// Usage:
+//
+//	lms keygen -out NAME [-type LMS_SHA256_M32_H10 [-bounded] | -height H]
+//	lms sign -key NAME -in FILE -out FILE.sig
+//	lms verify -pub NAME.pub -in FILE -sig FILE.sig
+//	lms pubkey -key NAME [-out NAME.pub]
+//	lms status -key NAME
+//	lms inspect -in FILE
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// commands maps the name of each subcommand to its handler, which
+// returns the exit code
+var commands = map[string]func(args []string, stdout, stderr io.Writer) int{
+	"keygen":  keygen,
+	"sign":    sign,
+	"verify":  verify,
+	"pubkey":  pubkey,
+	"status":  status,
+	"inspect": inspect,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the subcommand specified by args
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) < 1 {
+		usage(stderr)
+		return 2
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+
+	return cmd(args[1:], stdout, stderr)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: lms <command> [flags]")
+	fmt.Fprintln(w, "commands:")
+	fmt.Fprintln(w, "  keygen   generate a key pair")
+	fmt.Fprintln(w, "  sign     sign a file with a detached signature")
+	fmt.Fprintln(w, "  verify   verify a detached signature")
+	fmt.Fprintln(w, "  pubkey   extract the public key")
+	fmt.Fprintln(w, "  status   show the leaves left")
+	fmt.Fprintln(w, "  inspect  print a key, signature or agent state as JSON")
+	fmt.Fprintln(w, "run 'lms <command> -h' for flags of the command")
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LoCCS/lms"
+)
+
+// lmsRun runs the command, and returns its exit code and output
+func lmsRun(args ...string) (int, string, string) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	code := run(args, stdout, stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+// newTestDir makes a temporary directory holding a passphrase file
+// and a file to sign
+func newTestDir(t *testing.T) (dir, passfile, msgfile string) {
+	dir, err := ioutil.TempDir("", "lms-cmd")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	passfile = filepath.Join(dir, "pass")
+	if err := ioutil.WriteFile(passfile, []byte("correct horse battery staple\n"), 0600); nil != err {
+		t.Fatal(err)
+	}
+	msgfile = filepath.Join(dir, "msg")
+	if err := ioutil.WriteFile(msgfile, []byte("Hello, LMS"), 0644); nil != err {
+		t.Fatal(err)
+	}
+
+	return dir, passfile, msgfile
+}
+
+func TestKeygenSignVerify(t *testing.T) {
+	dir, passfile, msgfile := newTestDir(t)
+	defer os.RemoveAll(dir)
+	key := filepath.Join(dir, "key")
+
+	code, stdout, stderr := lmsRun("keygen", "-out", key, "-type", "LMS_SHA256_M32_H5", "-passfile", passfile)
+	if 0 != code {
+		t.Fatalf("keygen exits with %d: %s", code, stderr)
+	}
+
+	pkData, err := ioutil.ReadFile(key + pubSuffix)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(stdout) != hex.EncodeToString(pkData) {
+		t.Fatal("keygen prints a public key other than the written one")
+	}
+
+	// keys are never overwritten
+	if code, _, _ := lmsRun("keygen", "-out", key, "-passfile", passfile); 1 != code {
+		t.Fatalf("keygen over existing files exits with %d", code)
+	}
+
+	for i := 0; i < 3; i++ {
+		sigfile := filepath.Join(dir, "msg.sig")
+		if code, _, stderr := lmsRun("sign", "-key", key, "-in", msgfile, "-out", sigfile, "-passfile", passfile); 0 != code {
+			t.Fatalf("sign exits with %d: %s", code, stderr)
+		}
+
+		code, stdout, stderr := lmsRun("verify", "-pub", key+pubSuffix, "-in", msgfile, "-sig", sigfile)
+		if 0 != code {
+			t.Fatalf("verify exits with %d: %s", code, stderr)
+		}
+		if "OK\n" != stdout {
+			t.Fatalf("verify prints %q", stdout)
+		}
+	}
+
+	// the signature is the RFC 8554 one over the whole file
+	pk := new(lms.PublicKey)
+	if err := pk.UnmarshalBinary(pkData); nil != err {
+		t.Fatal(err)
+	}
+	msg, err := ioutil.ReadFile(msgfile)
+	if nil != err {
+		t.Fatal(err)
+	}
+	sigData, err := ioutil.ReadFile(filepath.Join(dir, "msg.sig"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	sig := new(lms.MerkleSig)
+	if err := sig.UnmarshalBinary(sigData); nil != err {
+		t.Fatal(err)
+	}
+	if err := pk.VerifyWithError(msg, sig); nil != err {
+		t.Fatal(err)
+	}
+
+	// status and pubkey need no passphrase
+	code, stdout, stderr = lmsRun("status", "-key", key)
+	if 0 != code {
+		t.Fatalf("status exits with %d: %s", code, stderr)
+	}
+	for _, want := range []string{"LMS_SHA256_M32_H5", "leaf index:    3", "remaining:     29 of 32", "exhausted:     false"} {
+		if !strings.Contains(stdout, want) {
+			t.Fatalf("status misses %q in %q", want, stdout)
+		}
+	}
+
+	pubfile := filepath.Join(dir, "extracted.pub")
+	if code, _, stderr := lmsRun("pubkey", "-key", key, "-out", pubfile); 0 != code {
+		t.Fatalf("pubkey exits with %d: %s", code, stderr)
+	}
+	extracted, err := ioutil.ReadFile(pubfile)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(extracted, pkData) {
+		t.Fatal("pubkey extracts a public key other than the generated one")
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	dir, passfile, msgfile := newTestDir(t)
+	defer os.RemoveAll(dir)
+	key := filepath.Join(dir, "key")
+	sigfile := filepath.Join(dir, "msg.sig")
+
+	if code, _, stderr := lmsRun("keygen", "-out", key, "-height", "3", "-passfile", passfile); 0 != code {
+		t.Fatalf("keygen exits with %d: %s", code, stderr)
+	}
+	if code, _, stderr := lmsRun("sign", "-key", key, "-in", msgfile, "-out", sigfile, "-passfile", passfile); 0 != code {
+		t.Fatalf("sign exits with %d: %s", code, stderr)
+	}
+
+	if err := ioutil.WriteFile(msgfile, []byte("Hello, LMT"), 0644); nil != err {
+		t.Fatal(err)
+	}
+	if code, _, _ := lmsRun("verify", "-pub", key+pubSuffix, "-in", msgfile, "-sig", sigfile); 1 != code {
+		t.Fatalf("verify of a tampered file exits with %d", code)
+	}
+}
+
+func TestSignUntilExhausted(t *testing.T) {
+	dir, passfile, msgfile := newTestDir(t)
+	defer os.RemoveAll(dir)
+	key := filepath.Join(dir, "key")
+	sigfile := filepath.Join(dir, "msg.sig")
+
+	if code, _, stderr := lmsRun("keygen", "-out", key, "-height", "2", "-passfile", passfile); 0 != code {
+		t.Fatalf("keygen exits with %d: %s", code, stderr)
+	}
+
+	for i := 0; i < 4; i++ {
+		if code, _, stderr := lmsRun("sign", "-key", key, "-in", msgfile, "-out", sigfile, "-passfile", passfile); 0 != code {
+			t.Fatalf("sign #%d exits with %d: %s", i, code, stderr)
+		}
+	}
+	if code, _, _ := lmsRun("sign", "-key", key, "-in", msgfile, "-out", sigfile, "-passfile", passfile); 1 != code {
+		t.Fatalf("sign with an exhausted key exits with %d", code)
+	}
+
+	code, stdout, stderr := lmsRun("status", "-key", key)
+	if 0 != code {
+		t.Fatalf("status exits with %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "exhausted:     true") {
+		t.Fatalf("status of an exhausted key prints %q", stdout)
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	dir, passfile, msgfile := newTestDir(t)
+	defer os.RemoveAll(dir)
+	key := filepath.Join(dir, "key")
+
+	if code, _, stderr := lmsRun("keygen", "-out", key, "-height", "2", "-passfile", passfile); 0 != code {
+		t.Fatalf("keygen exits with %d: %s", code, stderr)
+	}
+
+	os.Setenv(passphraseEnv, "wrong passphrase")
+	defer os.Unsetenv(passphraseEnv)
+
+	sigfile := filepath.Join(dir, "msg.sig")
+	if code, _, _ := lmsRun("sign", "-key", key, "-in", msgfile, "-out", sigfile); 1 != code {
+		t.Fatalf("sign under a wrong passphrase exits with %d", code)
+	}
+	if _, err := os.Stat(sigfile); !os.IsNotExist(err) {
+		t.Fatal("a signature is written under a wrong passphrase")
+	}
+}
+
+func TestUsage(t *testing.T) {
+	if code, _, _ := lmsRun(); 2 != code {
+		t.Fatalf("no command exits with %d", code)
+	}
+	if code, _, _ := lmsRun("frobnicate"); 2 != code {
+		t.Fatalf("unknown command exits with %d", code)
+	}
+	if code, _, _ := lmsRun("sign", "-key", "k"); 2 != code {
+		t.Fatalf("sign without -in exits with %d", code)
+	}
+	if code, _, _ := lmsRun("keygen", "-out", "k", "-height", "3", "-bounded"); 2 != code {
+		t.Fatalf("keygen with -height and -bounded exits with %d", code)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	dir, passfile, msgfile := newTestDir(t)
+	defer os.RemoveAll(dir)
+	key := filepath.Join(dir, "key")
+	sigfile := filepath.Join(dir, "msg.sig")
+
+	if code, _, stderr := lmsRun("keygen", "-out", key, "-type", "LMS_SHA256_M32_H5", "-passfile", passfile); 0 != code {
+		t.Fatalf("keygen exits with %d: %s", code, stderr)
+	}
+	if code, _, stderr := lmsRun("sign", "-key", key, "-in", msgfile, "-out", sigfile, "-passfile", passfile); 0 != code {
+		t.Fatalf("sign exits with %d: %s", code, stderr)
+	}
+
+	pkData, err := ioutil.ReadFile(key + pubSuffix)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pk := new(lms.PublicKey)
+	if err := pk.UnmarshalBinary(pkData); nil != err {
+		t.Fatal(err)
+	}
+	pemData, err := lms.MarshalPublicKeyPEM(pk)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pemfile := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(pemfile, pemData, 0644); nil != err {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		path string
+		want string
+	}{
+		{key + pubSuffix, `"type": "public key"`},
+		{sigfile, `"type": "signature"`},
+		{key + agentSuffix, `"type": "agent"`},
+		{pemfile, `"encoding": "pem"`},
+	} {
+		code, stdout, stderr := lmsRun("inspect", "-in", c.path)
+		if 0 != code {
+			t.Fatalf("inspect of %s exits with %d: %s", c.path, code, stderr)
+		}
+		if !strings.Contains(stdout, c.want) || !strings.Contains(stdout, "LMS_SHA256_M32_H5") {
+			t.Fatalf("inspect of %s prints %s", c.path, stdout)
+		}
+	}
+
+	if code, _, _ := lmsRun("inspect", "-in", msgfile); 1 != code {
+		t.Fatalf("inspect of an unknown blob exits with %d", code)
+	}
+}
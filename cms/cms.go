@@ -0,0 +1,608 @@
+// Package cms encodes and verifies CMS SignedData of RFC 5652 signed
+// by HSS/LMS keys according to RFC 8708. The signature algorithm is
+// id-alg-hss-lms-hashsig without parameters, and the signature value
+// is the HSS signature of RFC 8554 over the DER-encoded signed
+// attributes, or over the content itself if there are none. Only DER
+// encodings are parsed
+package cms
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/LoCCS/lms"
+	"github.com/LoCCS/lms/x509"
+	"golang.org/x/crypto/sha3"
+)
+
+// object identifiers of content types and attributes of RFC 5652
+var (
+	OIDData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	OIDSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+	OIDAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	OIDAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	OIDAttributeSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+)
+
+// object identifiers of digest algorithms
+var (
+	OIDDigestSHA256   = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	OIDDigestSHA3_256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 8}
+	OIDDigestSHAKE256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 12}
+)
+
+// lenSHAKE256 is the output length in bytes of SHAKE256 as a digest
+// algorithm of CMS according to RFC 8702
+const lenSHAKE256 = 64
+
+// SignOpts specifies how Sign encodes SignedData
+type SignOpts struct {
+	// Certificate identifies the signer by its issuer and serial number,
+	// and is embedded in the SignedData
+	Certificate *x509.Certificate
+	// SubjectKeyId identifies the signer if Certificate is nil, which
+	// is derived from the public key of the signer if empty
+	SubjectKeyId []byte
+	// Certificates are embedded along with Certificate, e.g., the
+	// intermediates of the signer
+	Certificates []*x509.Certificate
+
+	ContentType asn1.ObjectIdentifier // type of the content, id-data if nil
+	Detached    bool                  // leave the content out of the SignedData
+	SigningTime time.Time             // added as the signing-time attribute if non-zero
+
+	// NoSignedAttributes signs the content directly, which is only
+	// allowed for content of id-data
+	NoSignedAttributes bool
+
+	// LMSOpts is passed to lms.SignWithOpts for signers of *lms.MerkleAgent
+	LMSOpts *lms.SignOpts
+}
+
+// SignedData is the parsed CMS SignedData
+type SignedData struct {
+	Raw          []byte // DER-encoded ContentInfo
+	Version      int
+	ContentType  asn1.ObjectIdentifier
+	Content      []byte // nil if detached
+	Certificates []*x509.Certificate
+	SignerInfos  []*SignerInfo
+}
+
+// SignerInfo is the parsed CMS SignerInfo
+type SignerInfo struct {
+	Version int
+
+	// the signer is identified by either the issuer and serial number,
+	// or the subject key identifier
+	RawIssuer    []byte
+	SerialNumber *big.Int
+	SubjectKeyId []byte
+
+	DigestAlgorithm asn1.ObjectIdentifier
+
+	SignedAttributes []Attribute
+	// RawSignedAttributes is the DER encoding of the signed attributes
+	// as a SET OF, i.e., the signed message, which is nil if absent
+	RawSignedAttributes []byte
+
+	Signature []byte // HSS signature encoded according to RFC 8554
+}
+
+// Attribute is a CMS attribute
+type Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue
+}
+
+// contentInfo is the ASN.1 structure of ContentInfo
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+// signedData is the ASN.1 structure of SignedData for encoding
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"optional"`
+}
+
+// signerInfo is the ASN.1 structure of SignerInfo for encoding
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// signatureAlgorithm identifies HSS/LMS signatures without parameters
+var signatureAlgorithm = pkix.AlgorithmIdentifier{Algorithm: lms.OIDHSSLMSHashSig}
+
+// Sign encodes the content as SignedData signed by the signer, which
+// shall be *lms.MerkleAgent or *lms.HSS, and a leaf of it is used up.
+// The content-type and message-digest attributes are signed unless
+// opts.NoSignedAttributes, where the digest algorithm follows the hash
+// function of the top-level tree as RFC 8708 recommends
+func Sign(content []byte, signer interface{}, opts *SignOpts) ([]byte, error) {
+	if nil == opts {
+		opts = new(SignOpts)
+	}
+
+	pub, err := signerPublicKey(signer)
+	if nil != err {
+		return nil, err
+	}
+	digestOID := digestAlgorithmFor(pub.PublicKey.Typecode)
+
+	contentType := opts.ContentType
+	if nil == contentType {
+		contentType = OIDData
+	}
+	if opts.NoSignedAttributes && !contentType.Equal(OIDData) {
+		return nil, ErrContentTypeMismatch
+	}
+
+	si := signerInfo{
+		Version:            1,
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: digestOID},
+		SignatureAlgorithm: signatureAlgorithm,
+	}
+	if nil != opts.Certificate {
+		sid, err := asn1.Marshal(issuerAndSerialNumber{
+			Issuer:       asn1.RawValue{FullBytes: opts.Certificate.RawIssuer},
+			SerialNumber: opts.Certificate.SerialNumber,
+		})
+		if nil != err {
+			return nil, err
+		}
+		si.SID = asn1.RawValue{FullBytes: sid}
+	} else {
+		skid := opts.SubjectKeyId
+		if 0 == len(skid) {
+			if skid, err = keyID(pub); nil != err {
+				return nil, err
+			}
+		}
+		si.Version = 3
+		si.SID = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: skid}
+	}
+
+	msg := content
+	if !opts.NoSignedAttributes {
+		attrs, err := signedAttributes(contentType, digest(digestOID, content), opts.SigningTime)
+		if nil != err {
+			return nil, err
+		}
+		if msg, err = asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs}); nil != err {
+			return nil, err
+		}
+		si.SignedAttrs = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs}
+	}
+
+	if si.Signature, err = sign(signer, msg, opts.LMSOpts); nil != err {
+		return nil, err
+	}
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{si.DigestAlgorithm},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: contentType},
+		SignerInfos:      []signerInfo{si},
+	}
+	if (3 == si.Version) || !contentType.Equal(OIDData) {
+		sd.Version = 3
+	}
+
+	if !opts.Detached {
+		octets, err := asn1.Marshal(append([]byte{}, content...))
+		if nil != err {
+			return nil, err
+		}
+		sd.EncapContentInfo.EContent = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: octets}
+	}
+
+	certs := opts.Certificates
+	if nil != opts.Certificate {
+		certs = append([]*x509.Certificate{opts.Certificate}, certs...)
+	}
+	if len(certs) > 0 {
+		var raw []byte
+		for _, cert := range certs {
+			raw = append(raw, cert.Raw...)
+		}
+		sd.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw}
+	}
+
+	sdData, err := asn1.Marshal(sd)
+	if nil != err {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: OIDSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sdData},
+	})
+}
+
+// Parse parses the DER-encoded ContentInfo of SignedData
+func Parse(der []byte) (*SignedData, error) {
+	ci := new(contentInfo)
+	if rest, err := asn1.Unmarshal(der, ci); nil != err {
+		return nil, err
+	} else if 0 != len(rest) {
+		return nil, ErrMalformed
+	}
+	if !ci.ContentType.Equal(OIDSignedData) {
+		return nil, ErrNotSignedData
+	}
+	if !isContextSpecific(ci.Content, 0, true) {
+		return nil, ErrMalformed
+	}
+
+	var seq asn1.RawValue
+	if rest, err := asn1.Unmarshal(ci.Content.Bytes, &seq); nil != err {
+		return nil, err
+	} else if (0 != len(rest)) || (asn1.TagSequence != seq.Tag) {
+		return nil, ErrMalformed
+	}
+
+	fields, err := elements(seq.Bytes)
+	if nil != err {
+		return nil, err
+	}
+	// version, digestAlgorithms, encapContentInfo and signerInfos at least
+	if len(fields) < 4 {
+		return nil, ErrMalformed
+	}
+
+	sd := &SignedData{Raw: der}
+	if _, err := asn1.Unmarshal(fields[0].FullBytes, &sd.Version); nil != err {
+		return nil, err
+	}
+	if err := sd.parseEncapContentInfo(fields[2]); nil != err {
+		return nil, err
+	}
+
+	// the optional certificates [0] and crls [1]
+	signerInfos := fields[len(fields)-1]
+	for _, field := range fields[3 : len(fields)-1] {
+		switch {
+		case isContextSpecific(field, 0, true):
+			certs, err := elements(field.Bytes)
+			if nil != err {
+				return nil, err
+			}
+			for _, raw := range certs {
+				cert, err := x509.ParseCertificate(raw.FullBytes)
+				if nil != err {
+					// certificates of other algorithms are out of concern
+					continue
+				}
+				sd.Certificates = append(sd.Certificates, cert)
+			}
+		case isContextSpecific(field, 1, true):
+		default:
+			return nil, ErrMalformed
+		}
+	}
+
+	if asn1.TagSet != signerInfos.Tag {
+		return nil, ErrMalformed
+	}
+	infos, err := elements(signerInfos.Bytes)
+	if nil != err {
+		return nil, err
+	}
+	for _, raw := range infos {
+		si, err := parseSignerInfo(raw)
+		if nil != err {
+			return nil, err
+		}
+		sd.SignerInfos = append(sd.SignerInfos, si)
+	}
+
+	return sd, nil
+}
+
+// parseEncapContentInfo fills the content type and content
+func (sd *SignedData) parseEncapContentInfo(raw asn1.RawValue) error {
+	if asn1.TagSequence != raw.Tag {
+		return ErrMalformed
+	}
+
+	fields, err := elements(raw.Bytes)
+	if nil != err {
+		return err
+	}
+	if (len(fields) < 1) || (len(fields) > 2) {
+		return ErrMalformed
+	}
+
+	if _, err := asn1.Unmarshal(fields[0].FullBytes, &sd.ContentType); nil != err {
+		return err
+	}
+	if 1 == len(fields) {
+		return nil
+	}
+
+	if !isContextSpecific(fields[1], 0, true) {
+		return ErrMalformed
+	}
+	content := []byte{}
+	if rest, err := asn1.Unmarshal(fields[1].Bytes, &content); nil != err {
+		return err
+	} else if 0 != len(rest) {
+		return ErrMalformed
+	}
+	sd.Content = content
+
+	return nil
+}
+
+// parseSignerInfo parses the SignerInfo, whose unsigned attributes
+// are ignored
+func parseSignerInfo(raw asn1.RawValue) (*SignerInfo, error) {
+	if asn1.TagSequence != raw.Tag {
+		return nil, ErrMalformed
+	}
+
+	fields, err := elements(raw.Bytes)
+	if nil != err {
+		return nil, err
+	}
+	if len(fields) < 5 {
+		return nil, ErrMalformed
+	}
+
+	si := new(SignerInfo)
+	if _, err := asn1.Unmarshal(fields[0].FullBytes, &si.Version); nil != err {
+		return nil, err
+	}
+
+	switch sid := fields[1]; {
+	case (asn1.ClassUniversal == sid.Class) && (asn1.TagSequence == sid.Tag):
+		ias := new(issuerAndSerialNumber)
+		if _, err := asn1.Unmarshal(sid.FullBytes, ias); nil != err {
+			return nil, err
+		}
+		si.RawIssuer, si.SerialNumber = ias.Issuer.FullBytes, ias.SerialNumber
+	case isContextSpecific(sid, 0, false):
+		si.SubjectKeyId = sid.Bytes
+	default:
+		return nil, ErrMalformed
+	}
+
+	digestAlg := new(pkix.AlgorithmIdentifier)
+	if _, err := asn1.Unmarshal(fields[2].FullBytes, digestAlg); nil != err {
+		return nil, err
+	}
+	si.DigestAlgorithm = digestAlg.Algorithm
+
+	next := 3
+	if isContextSpecific(fields[next], 0, true) {
+		if si.SignedAttributes, err = parseAttributes(fields[next].Bytes); nil != err {
+			return nil, err
+		}
+		rawAttrs := asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: fields[next].Bytes}
+		if si.RawSignedAttributes, err = asn1.Marshal(rawAttrs); nil != err {
+			return nil, err
+		}
+		next++
+	}
+	if len(fields) < next+2 {
+		return nil, ErrMalformed
+	}
+
+	sigAlg := new(pkix.AlgorithmIdentifier)
+	if _, err := asn1.Unmarshal(fields[next].FullBytes, sigAlg); nil != err {
+		return nil, err
+	}
+	if !sigAlg.Algorithm.Equal(lms.OIDHSSLMSHashSig) || (0 != len(sigAlg.Parameters.FullBytes)) {
+		return nil, ErrSignatureAlgorithm
+	}
+
+	if _, err := asn1.Unmarshal(fields[next+1].FullBytes, &si.Signature); nil != err {
+		return nil, err
+	}
+
+	return si, nil
+}
+
+// parseAttributes parses the content of a SET OF attributes
+func parseAttributes(data []byte) ([]Attribute, error) {
+	raws, err := elements(data)
+	if nil != err {
+		return nil, err
+	}
+
+	attrs := make([]Attribute, len(raws))
+	for i, raw := range raws {
+		attr := new(attribute)
+		if rest, err := asn1.Unmarshal(raw.FullBytes, attr); nil != err {
+			return nil, err
+		} else if (0 != len(rest)) || (asn1.TagSet != attr.Values.Tag) {
+			return nil, ErrMalformed
+		}
+
+		values, err := elements(attr.Values.Bytes)
+		if nil != err {
+			return nil, err
+		}
+		attrs[i] = Attribute{attr.Type, values}
+	}
+
+	return attrs, nil
+}
+
+// signedAttributes encodes the content-type, message-digest and
+// optional signing-time attributes as the content of a DER SET OF,
+// whose elements are sorted by their encodings
+func signedAttributes(contentType asn1.ObjectIdentifier, digest []byte, signingTime time.Time) ([]byte, error) {
+	values := []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{OIDAttributeContentType, contentType},
+		{OIDAttributeMessageDigest, digest},
+	}
+	if !signingTime.IsZero() {
+		values = append(values, struct {
+			oid   asn1.ObjectIdentifier
+			value interface{}
+		}{OIDAttributeSigningTime, signingTime.UTC()})
+	}
+
+	encoded := make([][]byte, len(values))
+	for i, v := range values {
+		value, err := asn1.Marshal(v.value)
+		if nil != err {
+			return nil, err
+		}
+
+		encoded[i], err = asn1.Marshal(attribute{
+			Type:   v.oid,
+			Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+		})
+		if nil != err {
+			return nil, err
+		}
+	}
+
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+
+	return bytes.Join(encoded, nil), nil
+}
+
+// elements splits the content of a constructed value into elements
+func elements(data []byte) ([]asn1.RawValue, error) {
+	var out []asn1.RawValue
+	for 0 != len(data) {
+		var v asn1.RawValue
+		rest, err := asn1.Unmarshal(data, &v)
+		if nil != err {
+			return nil, err
+		}
+		out = append(out, v)
+		data = rest
+	}
+
+	return out, nil
+}
+
+// isContextSpecific checks if the value is of the context-specific tag
+func isContextSpecific(v asn1.RawValue, tag int, compound bool) bool {
+	return (asn1.ClassContextSpecific == v.Class) && (tag == v.Tag) && (compound == v.IsCompound)
+}
+
+// digestAlgorithmFor returns the digest algorithm going with the hash
+// function of the LMS typecode, i.e., SHA-256 and SHAKE256 for the
+// registered parameter sets, and SHA3-256 for the private-use ones
+func digestAlgorithmFor(typecode uint32) asn1.ObjectIdentifier {
+	switch {
+	case (typecode >= lms.LMS_SHA256_M32_H5) && (typecode <= lms.LMS_SHA256_M24_H25):
+		return OIDDigestSHA256
+	case (typecode >= lms.LMS_SHAKE_M32_H5) && (typecode <= lms.LMS_SHAKE_M24_H25):
+		return OIDDigestSHAKE256
+	}
+
+	return OIDDigestSHA3_256
+}
+
+// digest computes the digest of data by the algorithm, or nil if the
+// algorithm is unknown
+func digest(oid asn1.ObjectIdentifier, data []byte) []byte {
+	switch {
+	case oid.Equal(OIDDigestSHA256):
+		sum := sha256.Sum256(data)
+		return sum[:]
+	case oid.Equal(OIDDigestSHA3_256):
+		sum := sha3.Sum256(data)
+		return sum[:]
+	case oid.Equal(OIDDigestSHAKE256):
+		sum := make([]byte, lenSHAKE256)
+		h := sha3.NewShake256()
+		h.Write(data)
+		h.Read(sum)
+		return sum
+	}
+
+	return nil
+}
+
+// keyID derives the subject key identifier as the SHA-1 digest of the
+// HSS public key, as x509 does for certificates
+func keyID(pub *lms.HSSPublicKey) ([]byte, error) {
+	pkData, err := pub.MarshalBinary()
+	if nil != err {
+		return nil, err
+	}
+
+	sum := sha1.Sum(pkData)
+	return sum[:], nil
+}
+
+// signerPublicKey returns the HSS public key of the signer, where LMS
+// keys are of a single level
+func signerPublicKey(signer interface{}) (*lms.HSSPublicKey, error) {
+	switch s := signer.(type) {
+	case *lms.MerkleAgent:
+		return &lms.HSSPublicKey{Levels: 1, PublicKey: s.PublicKey()}, nil
+	case *lms.HSS:
+		return s.PublicKey(), nil
+	}
+
+	return nil, ErrUnsupportedSigner
+}
+
+// sign produces the HSS signature over the message encoded according
+// to RFC 8554, where LMS signatures go with no signed public keys
+func sign(signer interface{}, msg []byte, opts *lms.SignOpts) ([]byte, error) {
+	var hssSig *lms.HSSSig
+	switch s := signer.(type) {
+	case *lms.MerkleAgent:
+		sig, err := lms.SignWithOpts(s, msg, opts)
+		if nil != err {
+			return nil, err
+		}
+		hssSig = &lms.HSSSig{Sig: sig}
+	case *lms.HSS:
+		sig, err := s.Sign(msg)
+		if nil != err {
+			return nil, err
+		}
+		hssSig = sig
+	default:
+		return nil, ErrUnsupportedSigner
+	}
+
+	return hssSig.MarshalBinary()
+}
@@ -0,0 +1,339 @@
+package cms
+
+import (
+	"bytes"
+	"crypto/rand"
+	stdx509 "crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LoCCS/lmots"
+	"github.com/LoCCS/lms"
+	"github.com/LoCCS/lms/x509"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden fixtures in testdata")
+
+// golden fixtures signed deterministically by a tree of fixed seed and
+// I, which are rewritten by `go test -run Golden -update`. Rewritten
+// fixtures should be checked by an independent RFC 8554 verifier
+// before being committed
+var (
+	goldenSignedData = filepath.Join("testdata", "signed_data.der")
+	goldenPublicKey  = filepath.Join("testdata", "signer.pub")
+	goldenContent    = []byte("firmware image v1.0.0\n")
+)
+
+func newAgent(t *testing.T, typecode uint32) *lms.MerkleAgent {
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	agent, err := lms.NewMerkleAgentWithTypecode(typecode, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return agent
+}
+
+func TestSignAttached(t *testing.T) {
+	agent := newAgent(t, lms.LMS_SHA256_M32_H5)
+	content := []byte("Hello, CMS")
+
+	der, err := Sign(content, agent, &SignOpts{SigningTime: time.Now()})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	sd, err := Parse(der)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, sd.Content) || !sd.ContentType.Equal(OIDData) || (3 != sd.Version) {
+		t.Fatalf("invalid SignedData: %+v", sd)
+	}
+	if (1 != len(sd.SignerInfos)) || !sd.SignerInfos[0].DigestAlgorithm.Equal(OIDDigestSHA256) ||
+		(3 != len(sd.SignerInfos[0].SignedAttributes)) {
+		t.Fatalf("invalid SignerInfo: %+v", sd.SignerInfos)
+	}
+
+	if err := sd.Verify(agent.PublicKey()); nil != err {
+		t.Fatal(err)
+	}
+
+	// under another key
+	if err := sd.Verify(newAgent(t, lms.LMS_SHA256_M32_H5).PublicKey()); nil == err {
+		t.Fatal("SignedData is verified by another key")
+	}
+}
+
+func TestSignDetached(t *testing.T) {
+	agent := newAgent(t, lms.LMS_SHA256_M32_H5)
+	content := []byte("Hello, CMS")
+
+	der, err := Sign(content, agent, &SignOpts{Detached: true})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	sd, err := Parse(der)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if nil != sd.Content {
+		t.Fatal("detached content is encapsulated")
+	}
+
+	if err := sd.Verify(agent.PublicKey()); ErrDetached != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrDetached, err)
+	}
+	if err := sd.VerifyDetached(content, agent.PublicKey()); nil != err {
+		t.Fatal(err)
+	}
+	if err := sd.VerifyDetached([]byte("Hello, CMT"), agent.PublicKey()); ErrDigestMismatch != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrDigestMismatch, err)
+	}
+}
+
+func TestSignNoSignedAttributes(t *testing.T) {
+	agent := newAgent(t, lms.LMS_SHA256_M32_H5)
+	content := []byte("Hello, CMS")
+
+	der, err := Sign(content, agent, &SignOpts{NoSignedAttributes: true, Detached: true})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	sd, err := Parse(der)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if nil != sd.SignerInfos[0].RawSignedAttributes {
+		t.Fatal("signed attributes are present")
+	}
+
+	if err := sd.VerifyDetached(content, agent.PublicKey()); nil != err {
+		t.Fatal(err)
+	}
+	if err := sd.VerifyDetached([]byte("Hello, CMT"), agent.PublicKey()); lms.ErrRootMismatch != err {
+		t.Fatalf("invalid error: want %v, got %v", lms.ErrRootMismatch, err)
+	}
+
+	// content of other types needs the content-type attribute
+	_, err = Sign(content, agent, &SignOpts{
+		NoSignedAttributes: true,
+		ContentType:        asn1.ObjectIdentifier{1, 2, 3},
+	})
+	if ErrContentTypeMismatch != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrContentTypeMismatch, err)
+	}
+}
+
+func TestSignWithCertificate(t *testing.T) {
+	rootAgent := newAgent(t, lms.LMS_SHA256_M32_H5)
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+	signer, err := lms.NewHSS([]uint32{2, 2}, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              stdx509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rootTemplate, rootTemplate, rootAgent.PublicKey(), rootAgent)
+	if nil != err {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	signerTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Firmware Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     stdx509.KeyUsageDigitalSignature,
+	}
+	signerDER, err := x509.CreateCertificate(signerTemplate, root, signer.PublicKey(), rootAgent)
+	if nil != err {
+		t.Fatal(err)
+	}
+	signerCert, err := x509.ParseCertificate(signerDER)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	content := []byte("Hello, CMS")
+	der, err := Sign(content, signer, &SignOpts{Certificate: signerCert})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	sd, err := Parse(der)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if (1 != sd.Version) || (1 != sd.SignerInfos[0].Version) || (1 != len(sd.Certificates)) {
+		t.Fatalf("invalid versions or certificates: %+v", sd)
+	}
+
+	signers, err := sd.VerifyChain(x509.VerifyOptions{Roots: []*x509.Certificate{root}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if (1 != len(signers)) || !signers[0].Equal(signerCert) {
+		t.Fatal("invalid signer certificate")
+	}
+
+	// the signer doesn't chain up to another root
+	other := newAgent(t, lms.LMS_SHA256_M32_H5)
+	otherDER, err := x509.CreateCertificate(rootTemplate, rootTemplate, other.PublicKey(), other)
+	if nil != err {
+		t.Fatal(err)
+	}
+	otherRoot, err := x509.ParseCertificate(otherDER)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err := sd.VerifyChain(x509.VerifyOptions{Roots: []*x509.Certificate{otherRoot}}); nil == err {
+		t.Fatal("SignedData is verified under another root")
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	agent := newAgent(t, lms.LMS_SHA256_M32_H5)
+	der, err := Sign([]byte("Hello, CMS"), agent, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// every truncation is rejected without panics
+	for i := 0; i < len(der); i += 7 {
+		if _, err := Parse(der[:i]); nil == err {
+			t.Fatalf("truncated SignedData of %d bytes is accepted", i)
+		}
+	}
+
+	notSigned, err := asn1.Marshal(contentInfo{
+		ContentType: OIDData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: []byte{0x04, 0x00}},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err := Parse(notSigned); ErrNotSignedData != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrNotSignedData, err)
+	}
+}
+
+// newGoldenAgent makes the tree signing the golden fixtures
+func newGoldenAgent(t *testing.T) *lms.MerkleAgent {
+	seed := bytes.Repeat([]byte{0x5a}, lmots.N)
+	I := bytes.Repeat([]byte{0xa5}, 16)
+
+	agent, err := lms.NewMerkleAgentWithOptions(seed, &lms.AgentOpts{
+		Typecode: lms.LMS_SHA256_M32_H5,
+		I:        I,
+		Workers:  1,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return agent
+}
+
+func TestGoldenSignedData(t *testing.T) {
+	// the fixtures are reproduced byte for byte by deterministic signing
+	agent := newGoldenAgent(t)
+	signed, err := Sign(goldenContent, agent, &SignOpts{
+		SigningTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		LMSOpts:     &lms.SignOpts{Deterministic: true},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	signerData, err := agent.PublicKey().MarshalBinary()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if *update {
+		if err := ioutil.WriteFile(goldenSignedData, signed, 0644); nil != err {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(goldenPublicKey, signerData, 0644); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	der, err := ioutil.ReadFile(goldenSignedData)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pkData, err := ioutil.ReadFile(goldenPublicKey)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(signerData, pkData) {
+		t.Fatalf("invalid public key: want %x, got %x", pkData, signerData)
+	}
+	if !bytes.Equal(signed, der) {
+		t.Fatal("re-signing deterministically mismatches the golden SignedData")
+	}
+
+	pk := new(lms.PublicKey)
+	if err := pk.UnmarshalBinary(pkData); nil != err {
+		t.Fatal(err)
+	}
+
+	sd, err := Parse(der)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(goldenContent, sd.Content) {
+		t.Fatalf("invalid content: %q", sd.Content)
+	}
+
+	si := sd.SignerInfos[0]
+	var signingTime time.Time
+	if err := si.unmarshalAttribute(OIDAttributeSigningTime, &signingTime); nil != err {
+		t.Fatal(err)
+	}
+	if !signingTime.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("invalid signing time: %v", signingTime)
+	}
+
+	if err := sd.Verify(pk); nil != err {
+		t.Fatal(err)
+	}
+
+	// the encoding is stable from parsing to verification
+	tampered := append([]byte{}, der...)
+	tampered[len(tampered)-1] ^= 1
+	if sd, err := Parse(tampered); nil == err {
+		if nil == sd.Verify(pk) {
+			t.Fatal("tampered SignedData is verified")
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package cms
+
+import "errors"
+
+// Collections of errors while encoding and parsing SignedData
+var (
+	ErrUnsupportedSigner  = errors.New("signer should be *lms.MerkleAgent or *lms.HSS") // private key of unknown type
+	ErrNotSignedData      = errors.New("content isn't SignedData")                      // ContentInfo of another content type
+	ErrMalformed          = errors.New("malformed SignedData")                          // SignedData misses some components
+	ErrSignatureAlgorithm = errors.New("signature algorithm isn't HSS/LMS")             // SignerInfo isn't signed by HSS/LMS
+	ErrUnsupportedDigest  = errors.New("unsupported digest algorithm")                  // digest algorithm unknown to the package
+)
+
+// Collections of errors while verifying SignedData
+var (
+	ErrDetached            = errors.New("content is detached")                           // no content to verify is encapsulated
+	ErrNoSigner            = errors.New("no signer info")                                // SignedData carries no SignerInfo
+	ErrContentTypeMismatch = errors.New("content type attribute mismatches the content") // content-type attribute disagrees
+	ErrDigestMismatch      = errors.New("message digest mismatches the content")         // message-digest attribute disagrees
+	ErrMissingAttribute    = errors.New("required signed attribute is missing")          // content-type or message-digest is absent
+	ErrSignerNotFound      = errors.New("certificate of the signer isn't found")         // no certificate matches the signer identifier
+)
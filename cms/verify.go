@@ -0,0 +1,156 @@
+package cms
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/asn1"
+
+	"github.com/LoCCS/lms/x509"
+)
+
+// Verify checks every SignerInfo over the encapsulated content by the
+// public key, which shall be *lms.PublicKey or *lms.HSSPublicKey
+func (sd *SignedData) Verify(pub interface{}) error {
+	if nil == sd.Content {
+		return ErrDetached
+	}
+
+	return sd.VerifyDetached(sd.Content, pub)
+}
+
+// VerifyDetached works as Verify over the detached content
+func (sd *SignedData) VerifyDetached(content []byte, pub interface{}) error {
+	if 0 == len(sd.SignerInfos) {
+		return ErrNoSigner
+	}
+
+	for _, si := range sd.SignerInfos {
+		if err := si.verify(sd.ContentType, content, pub); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// VerifyChain checks every SignerInfo over the encapsulated content by
+// the key of the signer certificate found in the SignedData, which
+// shall chain up to the roots of opts, where the embedded certificates
+// are usable as intermediates. The signer certificates are returned
+func (sd *SignedData) VerifyChain(opts x509.VerifyOptions) ([]*x509.Certificate, error) {
+	if nil == sd.Content {
+		return nil, ErrDetached
+	}
+
+	return sd.VerifyChainDetached(sd.Content, opts)
+}
+
+// VerifyChainDetached works as VerifyChain over the detached content
+func (sd *SignedData) VerifyChainDetached(content []byte, opts x509.VerifyOptions) ([]*x509.Certificate, error) {
+	if 0 == len(sd.SignerInfos) {
+		return nil, ErrNoSigner
+	}
+
+	opts.Intermediates = append(append([]*x509.Certificate{}, opts.Intermediates...), sd.Certificates...)
+
+	signers := make([]*x509.Certificate, len(sd.SignerInfos))
+	for i, si := range sd.SignerInfos {
+		cert := si.findCertificate(sd.Certificates)
+		if nil == cert {
+			return nil, ErrSignerNotFound
+		}
+
+		if _, err := cert.Verify(opts); nil != err {
+			return nil, err
+		}
+		if err := si.verify(sd.ContentType, content, cert.PublicKey); nil != err {
+			return nil, err
+		}
+
+		signers[i] = cert
+	}
+
+	return signers, nil
+}
+
+// findCertificate returns the certificate identified by the signer
+// identifier, or nil if none
+func (si *SignerInfo) findCertificate(certs []*x509.Certificate) *x509.Certificate {
+	for _, cert := range certs {
+		if nil != si.SerialNumber {
+			if bytes.Equal(cert.RawIssuer, si.RawIssuer) && (0 == cert.SerialNumber.Cmp(si.SerialNumber)) {
+				return cert
+			}
+		} else if (0 != len(si.SubjectKeyId)) && bytes.Equal(cert.SubjectKeyId, si.SubjectKeyId) {
+			return cert
+		}
+	}
+
+	return nil
+}
+
+// verify checks the signed attributes against the content, and the
+// signature by x509.CheckSignature
+func (si *SignerInfo) verify(contentType asn1.ObjectIdentifier, content []byte, pub interface{}) error {
+	msg := content
+
+	if nil == si.RawSignedAttributes {
+		// the content type is implied to be id-data
+		if !contentType.Equal(OIDData) {
+			return ErrContentTypeMismatch
+		}
+	} else {
+		var attrType asn1.ObjectIdentifier
+		if err := si.unmarshalAttribute(OIDAttributeContentType, &attrType); nil != err {
+			return err
+		}
+		if !attrType.Equal(contentType) {
+			return ErrContentTypeMismatch
+		}
+
+		var attrDigest []byte
+		if err := si.unmarshalAttribute(OIDAttributeMessageDigest, &attrDigest); nil != err {
+			return err
+		}
+		sum := digest(si.DigestAlgorithm, content)
+		if nil == sum {
+			return ErrUnsupportedDigest
+		}
+		if 1 != subtle.ConstantTimeCompare(sum, attrDigest) {
+			return ErrDigestMismatch
+		}
+
+		msg = si.RawSignedAttributes
+	}
+
+	return x509.CheckSignature(pub, msg, si.Signature)
+}
+
+// unmarshalAttribute decodes the single value of the signed attribute
+// of the type, which shall appear exactly once
+func (si *SignerInfo) unmarshalAttribute(oid asn1.ObjectIdentifier, out interface{}) error {
+	var found *Attribute
+	for i := range si.SignedAttributes {
+		if si.SignedAttributes[i].Type.Equal(oid) {
+			if nil != found {
+				return ErrMalformed
+			}
+			found = &si.SignedAttributes[i]
+		}
+	}
+
+	if nil == found {
+		return ErrMissingAttribute
+	}
+	if 1 != len(found.Values) {
+		return ErrMalformed
+	}
+
+	if rest, err := asn1.Unmarshal(found.Values[0].FullBytes, out); nil != err {
+		return err
+	} else if 0 != len(rest) {
+		return ErrMalformed
+	}
+
+	return nil
+}
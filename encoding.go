@@ -3,10 +3,15 @@ package lms
 import (
 	"bytes"
 	"encoding/gob"
+
+	"github.com/LoCCS/lmots"
 )
 
-// Serialize marshals a prkg into gob bytes
+// Serialize marshals a prkg into gob bytes, where the intermediate
+// buffers of secret data are wiped
 func (prkg *KeyIterator) Serialize() ([]byte, error) {
+	defer prkg.secrets.wipeBuffers()
+
 	buf := new(bytes.Buffer)
 	if err := gob.NewEncoder(buf).Encode(prkg); nil != err {
 		return nil, err
@@ -20,24 +25,59 @@ func (prkg *KeyIterator) Deserialize(data []byte) error {
 	return gob.NewDecoder(bytes.NewBuffer(data)).Decode(prkg)
 }
 
-// Serialize marshals a MerkleSig into gob bytes
+// merkleSigEx is the gob template of MerkleSig, which keeps the legacy
+// gob format apart from the binary one given by MarshalBinary
+type merkleSigEx struct {
+	Opts  *lmots.LMOpts
+	LMSig *lmots.Sig
+
+	Auth     [][]byte
+	Typecode uint32
+}
+
+// Serialize marshals a MerkleSig into gob bytes, which is the legacy
+// format in favor of the RFC 8554 one produced by MarshalBinary
 func (sig *MerkleSig) Serialize() ([]byte, error) {
 	buf := new(bytes.Buffer)
 	enc := gob.NewEncoder(buf)
 
-	if err := enc.Encode(sig); nil != err {
+	if err := enc.Encode(&merkleSigEx{sig.Opts, sig.LMSig, sig.Auth, sig.Typecode}); nil != err {
 		return nil, err
 	}
 
 	return buf.Bytes(), nil
 }
 
-// Deserialize unmarshals the MerkleSig from gob bytes
+// Deserialize unmarshals the MerkleSig from gob bytes produced by
+// Serialize, where signatures missing any component or with components
+// of invalid length are rejected and leave sig untouched
 func (sig *MerkleSig) Deserialize(data []byte) error {
 	buf := bytes.NewBuffer(data)
 	dec := gob.NewDecoder(buf)
 
-	return dec.Decode(sig)
+	sigGob := new(merkleSigEx)
+	if err := dec.Decode(sigGob); nil != err {
+		return err
+	}
+
+	// signatures predating parameter sets are labelled by lmots
+	if (0 == sigGob.Typecode) && (nil != sigGob.Opts) && (nil != sigGob.LMSig) {
+		if sigGob.LMSig.Typecode != sigGob.Opts.Typecode {
+			return ErrMalformedSig
+		}
+		if err := fromLMOTSLabel(sigGob.Opts); nil != err {
+			return err
+		}
+		sigGob.LMSig.Typecode = sigGob.Opts.Typecode
+	}
+
+	merkleSig := &MerkleSig{sigGob.Opts, sigGob.LMSig, sigGob.Auth, sigGob.Typecode}
+	if _, err := merkleSig.validate(); nil != err {
+		return err
+	}
+	*sig = *merkleSig
+
+	return nil
 }
 
 // Serialize marshals the TreeHashStack as Gob bytes
@@ -0,0 +1,134 @@
+package lms
+
+import (
+	"encoding/binary"
+
+	"github.com/LoCCS/lmots"
+)
+
+// MarshalBinary encodes the signature as
+// `u32str(q)|lmots_signature|lms_type|path[0]|...|path[H-1]`
+// according to RFC 8554, where `lmots_signature=otstype|C|y[0]|...|y[p-1]`.
+// The key pair identifier I isn't part of the encoding, which is
+// supposed to be bound by the public key
+func (sig *MerkleSig) MarshalBinary() ([]byte, error) {
+	if (nil == sig.Opts) || (nil == sig.LMSig) {
+		return nil, ErrMalformedSig
+	}
+
+	ps, err := sig.paramSet()
+	if nil != err {
+		return nil, err
+	}
+
+	params, err := lookupOTSParams(sig.Opts)
+	if nil != err {
+		return nil, err
+	}
+	if (sig.LMSig.Typecode != sig.Opts.Typecode) || (len(sig.LMSig.C) != params.n) ||
+		(len(sig.LMSig.Sigma) != params.p) {
+		return nil, ErrMalformedSig
+	}
+
+	m := ps.M
+	for _, y := range sig.LMSig.Sigma {
+		if len(y) != params.n {
+			return nil, ErrMalformedSig
+		}
+	}
+	for _, node := range sig.Auth {
+		if len(node) != m {
+			return nil, ErrMalformedSig
+		}
+	}
+
+	data := make([]byte, 0, 12+(1+params.p)*params.n+int(ps.H)*m)
+
+	data = append(data, u32str(sig.Opts.KeyIdx)...)
+	// LM-OTS signature
+	data = append(data, sig.LMSig.Typecode[:]...)
+	data = append(data, sig.LMSig.C...)
+	for _, y := range sig.LMSig.Sigma {
+		data = append(data, y...)
+	}
+	// auth path
+	data = append(data, u32str(ps.Typecode)...)
+	for _, node := range sig.Auth {
+		data = append(data, node...)
+	}
+
+	return data, nil
+}
+
+// UnmarshalBinary decodes the signature from the RFC 8554 encoding.
+// The key pair identifier I of the decoded options is left zero,
+// and should be filled in from the public key before verification
+func (sig *MerkleSig) UnmarshalBinary(data []byte) error {
+	merkleSig, rest, err := parseMerkleSig(data)
+	if nil != err {
+		return err
+	}
+	if 0 != len(rest) {
+		return ErrInvalidLength
+	}
+
+	*sig = *merkleSig
+
+	return nil
+}
+
+// parseMerkleSig decodes the RFC 8554 encoded signature in the
+// front of data, and returns the remaining bytes
+func parseMerkleSig(data []byte) (*MerkleSig, []byte, error) {
+	// u32str(q)|otstype
+	if len(data) < 8 {
+		return nil, nil, ErrInvalidLength
+	}
+
+	opts := new(lmots.LMOpts)
+	opts.KeyIdx = binary.BigEndian.Uint32(data)
+	copy(opts.Typecode[:], data[4:8])
+
+	params, err := lookupOTSParams(opts)
+	if nil != err {
+		return nil, nil, err
+	}
+
+	// C|y[0]|...|y[p-1]|lms_type
+	offset := 8 + (1+params.p)*params.n
+	if len(data) < offset+4 {
+		return nil, nil, ErrInvalidLength
+	}
+
+	lmSig := new(lmots.Sig)
+	copy(lmSig.Typecode[:], data[4:8])
+	lmSig.C = make([]byte, params.n)
+	copy(lmSig.C, data[8:])
+
+	lmSig.Sigma = make([][]byte, params.p)
+	for i := range lmSig.Sigma {
+		lmSig.Sigma[i] = make([]byte, params.n)
+		copy(lmSig.Sigma[i], data[8+(i+1)*params.n:])
+	}
+
+	ps, err := LookupParamSet(binary.BigEndian.Uint32(data[offset:]))
+	if nil != err {
+		return nil, nil, err
+	}
+	offset += 4
+
+	m := ps.M
+	if len(data) < offset+int(ps.H)*m {
+		return nil, nil, ErrInvalidLength
+	}
+
+	auth := make([][]byte, ps.H)
+	for i := range auth {
+		auth[i] = make([]byte, m)
+		copy(auth[i], data[offset+i*m:])
+	}
+
+	merkleSig := &MerkleSig{Opts: opts, LMSig: lmSig, Auth: auth, Typecode: ps.Typecode}
+
+	return merkleSig, data[offset+int(ps.H)*m:], nil
+}
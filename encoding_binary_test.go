@@ -0,0 +1,137 @@
+package lms
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/LoCCS/lmots"
+)
+
+func TestMerkleSigBinaryEncoding(t *testing.T) {
+	const H = 4
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	msg := make([]byte, lmots.N)
+	if _, err := rand.Read(msg); nil != err {
+		t.Fatal(err)
+	}
+
+	sig, err := Sign(merkleAgent, msg)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	data, err := sig.MarshalBinary()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if want := 12 + (1+len(sig.LMSig.Sigma))*lmots.N + H*HashFunc().Size(); len(data) != want {
+		t.Fatalf("invalid length: want %v, got %v", want, len(data))
+	}
+
+	sig2 := new(MerkleSig)
+	if err := sig2.UnmarshalBinary(data); nil != err {
+		t.Fatal(err)
+	}
+
+	if sig.Opts.KeyIdx != sig2.Opts.KeyIdx {
+		t.Fatalf("invalid q: want %v, got %v", sig.Opts.KeyIdx, sig2.Opts.KeyIdx)
+	}
+	if !isLMSigEqual(sig.LMSig, sig2.LMSig) {
+		t.Fatal("invalid OTS signature")
+	}
+	if len(sig.Auth) != len(sig2.Auth) {
+		t.Fatalf("invalid len(Auth): want %v, got %v", len(sig.Auth), len(sig2.Auth))
+	}
+	for i := range sig.Auth {
+		if !bytes.Equal(sig.Auth[i], sig2.Auth[i]) {
+			t.Fatalf("invalid Auth[%v]: want %x, got %x", i, sig.Auth[i], sig2.Auth[i])
+		}
+	}
+
+	// I is bound by the public key rather than the signature
+	if !merkleAgent.PublicKey().Verify(msg, sig2) {
+		t.Fatal("verification failed")
+	}
+
+	if data2, err := sig2.MarshalBinary(); nil != err {
+		t.Fatal(err)
+	} else if !bytes.Equal(data, data2) {
+		t.Fatalf("invalid encoding: want %x, got %x", data, data2)
+	}
+}
+
+func TestMerkleSigBinaryInvalidLength(t *testing.T) {
+	merkleSig, err := mockUpMerkleSig()
+	if nil != err {
+		t.Fatal(err)
+	}
+	for i := range merkleSig.Auth {
+		merkleSig.Auth[i] = make([]byte, HashFunc().Size())
+	}
+
+	data, err := merkleSig.MarshalBinary()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	for _, bad := range [][]byte{
+		data[:len(data)-1],
+		append(data[:len(data):len(data)], 0x00),
+		data[:8+lmots.N],
+		data[4:],
+	} {
+		if err := new(MerkleSig).UnmarshalBinary(bad); nil == err {
+			t.Fatalf("expect error for data of length %v", len(bad))
+		}
+	}
+}
+
+func TestPublicKeyBinaryEncoding(t *testing.T) {
+	opts := lmots.NewLMOpts()
+
+	pk := &PublicKey{
+		Typecode:    privateTypecode(10),
+		OtsTypecode: otsTypecode(opts),
+		I:           opts.I[:],
+		Root:        make([]byte, HashFunc().Size()),
+		Height:      10,
+	}
+	if _, err := rand.Read(pk.Root); nil != err {
+		t.Fatal(err)
+	}
+
+	data, err := pk.MarshalBinary()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	pk2 := new(PublicKey)
+	if err := pk2.UnmarshalBinary(data); nil != err {
+		t.Fatal(err)
+	}
+
+	if (pk.Typecode != pk2.Typecode) || (pk.OtsTypecode != pk2.OtsTypecode) ||
+		!bytes.Equal(pk.I, pk2.I) || !bytes.Equal(pk.Root, pk2.Root) ||
+		(pk.Height != pk2.Height) {
+		t.Fatalf("invalid public key: want %+v, got %+v", pk, pk2)
+	}
+
+	if err := pk2.UnmarshalBinary(data[:len(data)-1]); ErrInvalidLength != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrInvalidLength, err)
+	}
+	if err := pk2.UnmarshalBinary(append(data, 0x00)); ErrInvalidLength != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrInvalidLength, err)
+	}
+}
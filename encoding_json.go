@@ -0,0 +1,355 @@
+package lms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/LoCCS/lmots"
+)
+
+// hexBytes is a byte slice encoded as a hex string in JSON, where
+// whitespace is ignored on decoding so that test vectors can be pasted
+// from the RFC as they are
+type hexBytes []byte
+
+// MarshalText encodes the bytes as a hex string
+func (b hexBytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(b)), nil
+}
+
+// UnmarshalText decodes the bytes from a hex string
+func (b *hexBytes) UnmarshalText(text []byte) error {
+	data, err := hex.DecodeString(strings.Join(strings.Fields(string(text)), ""))
+	if nil != err {
+		return err
+	}
+	*b = data
+
+	return nil
+}
+
+// toHexSlice converts nodes into hexBytes for JSON encoding
+func toHexSlice(nodes [][]byte) []hexBytes {
+	out := make([]hexBytes, len(nodes))
+	for i := range nodes {
+		out[i] = nodes[i]
+	}
+
+	return out
+}
+
+// fromHexSlice converts hexBytes decoded from JSON back into nodes
+func fromHexSlice(nodes []hexBytes) [][]byte {
+	out := make([][]byte, len(nodes))
+	for i := range nodes {
+		out[i] = nodes[i]
+	}
+
+	return out
+}
+
+// paramSetName returns the name of the LMS parameter set, or empty
+// if the typecode is unknown
+func paramSetName(typecode uint32) string {
+	ps, err := LookupParamSet(typecode)
+	if nil != err {
+		return ""
+	}
+
+	return ps.Name
+}
+
+// merkleSigJSON is the JSON template of MerkleSig, where Name is
+// informative only and ignored on decoding
+type merkleSigJSON struct {
+	Typecode    uint32     `json:"typecode"`
+	Name        string     `json:"name,omitempty"`
+	OtsTypecode uint32     `json:"otsTypecode"`
+	I           hexBytes   `json:"i"`
+	Q           uint32     `json:"q"`
+	C           hexBytes   `json:"c"`
+	Y           []hexBytes `json:"y"`
+	Path        []hexBytes `json:"path"`
+}
+
+// MarshalJSON encodes the signature as JSON with binary fields in hex
+func (sig *MerkleSig) MarshalJSON() ([]byte, error) {
+	if (nil == sig.Opts) || (nil == sig.LMSig) {
+		return nil, ErrMalformedSig
+	}
+
+	sigJSON := &merkleSigJSON{
+		Typecode:    sig.Typecode,
+		OtsTypecode: otsTypecode(sig.Opts),
+		I:           sig.Opts.I[:],
+		Q:           sig.Opts.KeyIdx,
+		C:           sig.LMSig.C,
+		Y:           toHexSlice(sig.LMSig.Sigma),
+		Path:        toHexSlice(sig.Auth),
+	}
+	if ps, err := sig.paramSet(); nil == err {
+		sigJSON.Name = ps.Name
+	}
+
+	return json.Marshal(sigJSON)
+}
+
+// UnmarshalJSON decodes the signature from JSON made by MarshalJSON,
+// where malformed signatures are rejected as Deserialize does
+func (sig *MerkleSig) UnmarshalJSON(data []byte) error {
+	sigJSON := new(merkleSigJSON)
+	if err := json.Unmarshal(data, sigJSON); nil != err {
+		return err
+	}
+
+	opts := new(lmots.LMOpts)
+	if (0 != len(sigJSON.I)) && (len(sigJSON.I) != len(opts.I)) {
+		return ErrMalformedSig
+	}
+	copy(opts.I[:], sigJSON.I)
+	binary.BigEndian.PutUint32(opts.Typecode[:], sigJSON.OtsTypecode)
+	opts.KeyIdx = sigJSON.Q
+
+	lmSig := &lmots.Sig{
+		Typecode: opts.Typecode,
+		C:        sigJSON.C,
+		Sigma:    fromHexSlice(sigJSON.Y),
+	}
+
+	merkleSig := &MerkleSig{opts, lmSig, fromHexSlice(sigJSON.Path), sigJSON.Typecode}
+	if _, err := merkleSig.validate(); nil != err {
+		return err
+	}
+	*sig = *merkleSig
+
+	return nil
+}
+
+// publicKeyJSON is the JSON template of PublicKey, where Name is
+// informative only and ignored on decoding
+type publicKeyJSON struct {
+	Typecode    uint32   `json:"typecode"`
+	Name        string   `json:"name,omitempty"`
+	OtsTypecode uint32   `json:"otsTypecode"`
+	I           hexBytes `json:"i"`
+	Root        hexBytes `json:"root"`
+	Height      uint32   `json:"height"`
+}
+
+// MarshalJSON encodes the public key as JSON with binary fields in hex
+func (pk *PublicKey) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&publicKeyJSON{
+		Typecode:    pk.Typecode,
+		Name:        paramSetName(pk.Typecode),
+		OtsTypecode: pk.OtsTypecode,
+		I:           pk.I,
+		Root:        pk.Root,
+		Height:      pk.Height,
+	})
+}
+
+// UnmarshalJSON decodes the public key from JSON made by MarshalJSON,
+// where keys mismatching their parameter set are rejected
+func (pk *PublicKey) UnmarshalJSON(data []byte) error {
+	pkJSON := new(publicKeyJSON)
+	if err := json.Unmarshal(data, pkJSON); nil != err {
+		return err
+	}
+
+	ps, err := LookupParamSet(pkJSON.Typecode)
+	if nil != err {
+		return err
+	}
+	if (len(pkJSON.I) != lenI) || (len(pkJSON.Root) != ps.M) || (pkJSON.Height != ps.H) {
+		return ErrMalformedPubKey
+	}
+
+	*pk = PublicKey{
+		Typecode:    pkJSON.Typecode,
+		OtsTypecode: pkJSON.OtsTypecode,
+		I:           pkJSON.I,
+		Root:        pkJSON.Root,
+		Height:      pkJSON.Height,
+	}
+
+	return nil
+}
+
+// AgentView is a redacted view of MerkleAgent for inspection,
+// which carries no secret data
+type AgentView struct {
+	Typecode       uint32
+	H              uint32
+	Root           []byte
+	LeafIdx        *uint32 // nil if unknown, e.g., parsed from the public data alone
+	Auth           [][]byte
+	TreeHashStacks []*TreeHashStackView
+}
+
+// TreeHashStackView is a view of TreeHashStack for inspection
+type TreeHashStackView struct {
+	Height    uint32 // height of the targeted Merkle tree
+	Leaf      uint32
+	LeafUpper uint32
+	Nodes     []*Node // nodes from the bottom of the stack
+}
+
+// View returns the redacted view of the agent
+func (agent *MerkleAgent) View() *AgentView {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	view := agent.view()
+	leafIdx := agent.leafIdx()
+	view.LeafIdx = &leafIdx
+
+	return view
+}
+
+// view is View without locking and leaf index, which is kept by the
+// secret data
+func (agent *MerkleAgent) view() *AgentView {
+	view := &AgentView{
+		Typecode:       agent.params.Typecode,
+		H:              agent.H,
+		Root:           append([]byte{}, agent.Root...),
+		Auth:           make([][]byte, len(agent.auth)),
+		TreeHashStacks: make([]*TreeHashStackView, len(agent.treeHashStacks)),
+	}
+	for i := range agent.auth {
+		view.Auth[i] = append([]byte{}, agent.auth[i]...)
+	}
+
+	for i, th := range agent.treeHashStacks {
+		values := th.nodeStack.ValueSlice()
+		thView := &TreeHashStackView{
+			Height:    th.height,
+			Leaf:      th.leaf,
+			LeafUpper: th.leafUpper,
+			Nodes:     make([]*Node, len(values)),
+		}
+		for j, v := range values {
+			node := v.(*Node)
+			thView.Nodes[j] = &Node{node.Height, append([]byte{}, node.Nu...), node.Index}
+		}
+		view.TreeHashStacks[i] = thView
+	}
+
+	return view
+}
+
+// ParseAgentView makes the view of the agent from its public data
+// given by Serialize, whose leaf index is unknown
+func ParseAgentView(public []byte) (*AgentView, error) {
+	agent := new(MerkleAgent)
+	if err := gob.NewDecoder(bytes.NewBuffer(public)).Decode(agent); nil != err {
+		return nil, err
+	}
+
+	return agent.view(), nil
+}
+
+// MarshalJSON encodes the redacted view of the agent as JSON, where
+// no secret data is exposed
+func (agent *MerkleAgent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(agent.View())
+}
+
+// nodeJSON is the JSON template of Node
+type nodeJSON struct {
+	Height uint32   `json:"height"`
+	Index  uint32   `json:"index"`
+	Nu     hexBytes `json:"nu"`
+}
+
+// treeHashStackJSON is the JSON template of TreeHashStackView
+type treeHashStackJSON struct {
+	Height    uint32      `json:"height"`
+	Leaf      uint32      `json:"leaf"`
+	LeafUpper uint32      `json:"leafUpper"`
+	Nodes     []*nodeJSON `json:"nodes"`
+}
+
+// agentViewJSON is the JSON template of AgentView, where Name is
+// informative only and ignored on decoding
+type agentViewJSON struct {
+	Typecode       uint32               `json:"typecode"`
+	Name           string               `json:"name,omitempty"`
+	H              uint32               `json:"h"`
+	Root           hexBytes             `json:"root"`
+	LeafIdx        *uint32              `json:"leafIdx,omitempty"`
+	Auth           []hexBytes           `json:"auth"`
+	TreeHashStacks []*treeHashStackJSON `json:"treeHashStacks"`
+}
+
+// MarshalJSON encodes the view as JSON with binary fields in hex
+func (view *AgentView) MarshalJSON() ([]byte, error) {
+	viewJSON := &agentViewJSON{
+		Typecode:       view.Typecode,
+		Name:           paramSetName(view.Typecode),
+		H:              view.H,
+		Root:           view.Root,
+		LeafIdx:        view.LeafIdx,
+		Auth:           toHexSlice(view.Auth),
+		TreeHashStacks: make([]*treeHashStackJSON, len(view.TreeHashStacks)),
+	}
+
+	for i, th := range view.TreeHashStacks {
+		thJSON := &treeHashStackJSON{
+			Height:    th.Height,
+			Leaf:      th.Leaf,
+			LeafUpper: th.LeafUpper,
+			Nodes:     make([]*nodeJSON, len(th.Nodes)),
+		}
+		for j, node := range th.Nodes {
+			thJSON.Nodes[j] = &nodeJSON{node.Height, node.Index, node.Nu}
+		}
+		viewJSON.TreeHashStacks[i] = thJSON
+	}
+
+	return json.Marshal(viewJSON)
+}
+
+// UnmarshalJSON decodes the view from JSON made by MarshalJSON
+func (view *AgentView) UnmarshalJSON(data []byte) error {
+	viewJSON := new(agentViewJSON)
+	if err := json.Unmarshal(data, viewJSON); nil != err {
+		return err
+	}
+
+	restored := &AgentView{
+		Typecode:       viewJSON.Typecode,
+		H:              viewJSON.H,
+		Root:           viewJSON.Root,
+		LeafIdx:        viewJSON.LeafIdx,
+		Auth:           fromHexSlice(viewJSON.Auth),
+		TreeHashStacks: make([]*TreeHashStackView, len(viewJSON.TreeHashStacks)),
+	}
+
+	for i, thJSON := range viewJSON.TreeHashStacks {
+		if nil == thJSON {
+			return ErrInvalidState
+		}
+
+		th := &TreeHashStackView{
+			Height:    thJSON.Height,
+			Leaf:      thJSON.Leaf,
+			LeafUpper: thJSON.LeafUpper,
+			Nodes:     make([]*Node, len(thJSON.Nodes)),
+		}
+		for j, node := range thJSON.Nodes {
+			if nil == node {
+				return ErrInvalidState
+			}
+			th.Nodes[j] = &Node{node.Height, node.Nu, node.Index}
+		}
+		restored.TreeHashStacks[i] = th
+	}
+	*view = *restored
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package lms
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/LoCCS/lmots"
+)
+
+func TestMerkleSigJSONEncoding(t *testing.T) {
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	merkleAgent, err := NewMerkleAgentWithTypecode(LMS_SHA256_M32_H5, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	msg := []byte("Hello, LMS")
+	sig, err := Sign(merkleAgent, msg)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(sig)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"name":"LMS_SHA256_M32_H5"`) {
+		t.Fatalf("missing name of the parameter set in %s", data)
+	}
+
+	sig2 := new(MerkleSig)
+	if err := json.Unmarshal(data, sig2); nil != err {
+		t.Fatal(err)
+	}
+	if !merkleAgent.PublicKey().Verify(msg, sig2) {
+		t.Fatal("verification failed")
+	}
+
+	// the auth path of a shorter length is rejected
+	sig.Auth = sig.Auth[1:]
+	data, err = json.Marshal(sig)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, new(MerkleSig)); nil == err {
+		t.Fatal("truncated auth path is accepted")
+	}
+}
+
+func TestPublicKeyJSONEncoding(t *testing.T) {
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	merkleAgent, err := NewMerkleAgent(4, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	pk := merkleAgent.PublicKey()
+	data, err := json.Marshal(pk)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	pk2 := new(PublicKey)
+	if err := json.Unmarshal(data, pk2); nil != err {
+		t.Fatal(err)
+	}
+	if !pk.Equal(pk2) {
+		t.Fatalf("invalid public key: want %+v, got %+v", pk, pk2)
+	}
+
+	pk.Root = pk.Root[1:]
+	if data, err = json.Marshal(pk); nil != err {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, new(PublicKey)); ErrMalformedPubKey != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrMalformedPubKey, err)
+	}
+}
+
+func TestAgentViewJSONEncoding(t *testing.T) {
+	const H = 4
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := Sign(merkleAgent, []byte("Hello, LMS")); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := json.Marshal(merkleAgent)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// no secret data is exposed
+	secret := merkleAgent.keyItr.seed
+	for _, s := range []string{"seed", "Seed", hex.EncodeToString(secret)} {
+		if strings.Contains(string(data), s) {
+			t.Fatalf("secret data %q is exposed in %s", s, data)
+		}
+	}
+
+	view := new(AgentView)
+	if err := json.Unmarshal(data, view); nil != err {
+		t.Fatal(err)
+	}
+	if (nil == view.LeafIdx) || (3 != *view.LeafIdx) {
+		t.Fatalf("invalid leaf index: want 3, got %v", view.LeafIdx)
+	}
+	if (H != view.H) || !bytes.Equal(merkleAgent.Root, view.Root) {
+		t.Fatal("invalid height or root")
+	}
+	if (H != len(view.Auth)) || (H != len(view.TreeHashStacks)) {
+		t.Fatalf("invalid number of auth nodes or stacks: %v, %v", len(view.Auth),
+			len(view.TreeHashStacks))
+	}
+	for i := range view.Auth {
+		if !bytes.Equal(merkleAgent.auth[i], view.Auth[i]) {
+			t.Fatalf("invalid Auth[%v]", i)
+		}
+	}
+	for h, th := range view.TreeHashStacks {
+		if (merkleAgent.treeHashStacks[h].leaf != th.Leaf) ||
+			(merkleAgent.treeHashStacks[h].leafUpper != th.LeafUpper) ||
+			(merkleAgent.treeHashStacks[h].nodeStack.Len() != len(th.Nodes)) {
+			t.Fatalf("invalid tree hash stack %v", h)
+		}
+	}
+
+	// the view from the public data lacks the leaf index only
+	public, err := merkleAgent.Serialize()
+	if nil != err {
+		t.Fatal(err)
+	}
+	parsed, err := ParseAgentView(public)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if nil != parsed.LeafIdx {
+		t.Fatalf("leaf index %v is known from the public data", *parsed.LeafIdx)
+	}
+	parsed.LeafIdx = view.LeafIdx
+	data2, err := json.Marshal(parsed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, data2) {
+		t.Fatalf("invalid view: want %s, got %s", data, data2)
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"golang.org/x/crypto/sha3"
 
 	"github.com/LoCCS/lmots"
-	lmrand "github.com/LoCCS/lmots/rand"
 	"github.com/LoCCS/lms/container/stack"
 )
 
@@ -18,25 +17,31 @@ func mockUpMerkleSig() (*MerkleSig, error) {
 	hash := sha3.Sum256([]byte("Hello LMS"))
 
 	dummyOpts := lmots.NewLMOpts()
-	sk, err := lmots.GenerateKey(dummyOpts, rand.Reader)
+	setOTSTypecode(dummyOpts, LMOTS_SHAKE_N32_W4)
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		return nil, err
+	}
+	sk, err := otsGenerateKey(dummyOpts, seed)
 	if nil != err {
 		return nil, err
 	}
 
-	sig, err := lmots.Sign(rand.Reader, sk, hash[:])
+	sig, err := otsSign(rand.Reader, sk, hash[:])
 	if nil != err {
 		return nil, err
 	}
 
 	const H = 16
 	merkleSig := &MerkleSig{
-		Opts:  sk.PublicKey.Opts,
-		LMSig: sig,
+		Opts:     sk.PublicKey.Opts,
+		LMSig:    sig,
+		Typecode: privateTypecode(H),
 	}
 
 	merkleSig.Auth = make([][]byte, H)
 	for i := range merkleSig.Auth {
-		merkleSig.Auth[i] = make([]byte, 3)
+		merkleSig.Auth[i] = make([]byte, lmots.N)
 		if _, err := rand.Read(merkleSig.Auth[i]); nil != err {
 			return nil, err
 		}
@@ -52,9 +57,10 @@ func mockUpPRKG() (*KeyIterator, error) {
 	}
 
 	prkg := new(KeyIterator)
-	prkg.rng = lmrand.New(seed)
+	prkg.rngSeed = seed
 	prkg.offset = mathrand.Uint32()
 	prkg.LMOpts = lmots.NewLMOpts()
+	setOTSTypecode(prkg.LMOpts, LMOTS_SHAKE_N32_W4)
 
 	if _, err := rand.Read(prkg.LMOpts.I[:]); nil != err {
 		return nil, err
@@ -67,14 +73,14 @@ func mockUpTreeHashStack() (*TreeHashStack, error) {
 	ths := new(TreeHashStack)
 
 	ths.leaf = mathrand.Uint32() % 1024
-	ths.leafUpper = ths.leaf + 256
 	ths.height = mathrand.Uint32()%20 + 1
+	ths.leafUpper = ths.leaf + (1 << ths.height)
 
 	ths.nodeStack = stack.New()
-	ell := mathrand.Uint32() % 32
+	ell := mathrand.Uint32() % (ths.height + 1)
 	for i := uint32(0); i < ell; i++ {
 		node := &Node{
-			Height: mathrand.Uint32(),
+			Height: ths.height - i - 1,
 			Nu:     make([]byte, lmots.N),
 			Index:  mathrand.Uint32(),
 		}
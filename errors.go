@@ -6,4 +6,34 @@ import "errors"
 var (
 	ErrInvalidHeight = errors.New("H should be larger than 1")              // merkle tree should be of height at least 2
 	ErrOutOfKeys     = errors.New("key pairs on the tree are totally used") // no more keys to use
+	ErrInvalidLevels = errors.New("L should be within [1, 8]")              // number of levels of HSS
+	ErrInvalidState  = errors.New("restored state is inconsistent")         // decoded HSS, agent or tree hash stack is corrupted
+	ErrNotPositional = errors.New("keys can only be drawn sequentially")    // key iterator can't derive keys by index
+	ErrStateMismatch = errors.New("state belongs to another key")           // state store records another tree
+	ErrDestroyed     = errors.New("secret key material is destroyed")       // agent or key iterator is closed
+
+	ErrParamSetMismatch = errors.New("parameter set mismatches the LM-OTS keys") // tree and OTS keys differ in hash or length
+)
+
+// Collections of errors while encoding and decoding
+var (
+	ErrInvalidLength   = errors.New("data is of invalid length") // encoded data doesn't match the expected size
+	ErrUnknownTypecode = errors.New("unsupported LMS typecode")  // typecode isn't recognized by the package
+	ErrMalformedSig    = errors.New("malformed LMS signature")   // signature misses some components
+	ErrMalformedPubKey = errors.New("malformed LMS public key")  // public key misses some components
+
+	ErrUnsupportedEnvelope = errors.New("unsupported secret key envelope")         // envelope is of unknown format or parameters
+	ErrDecryption          = errors.New("wrong passphrase or tampered secret key") // envelope fails authentication
+
+	ErrUnsupportedAlgorithm = errors.New("algorithm isn't HSS/LMS")      // SubjectPublicKeyInfo of another algorithm
+	ErrNoPEMBlock           = errors.New("no PEM block of a public key") // data holds no PEM block of type PUBLIC KEY
+)
+
+// Collections of errors while verifying signatures
+var (
+	ErrIndexOutOfRange  = errors.New("leaf index is out of range")             // leaf index isn't less than 2^H
+	ErrAuthPathLength   = errors.New("auth path mismatches the tree height")   // number of nodes on auth path isn't H
+	ErrTypecodeMismatch = errors.New("typecode mismatches the public key")     // LMS or LM-OTS typecode disagrees
+	ErrKeyIDMismatch    = errors.New("key pair identifier mismatches the key") // I of signature disagrees with the key
+	ErrRootMismatch     = errors.New("recovered root mismatches the key")      // signature is forged or over another message
 )
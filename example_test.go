@@ -19,7 +19,7 @@ func ExampleVerify() {
 	msg := make([]byte, lmots.N)
 	rand.Reader.Read(msg)
 	// what if no more leaf to use in the Merkle agent
-	_, sig, err := Sign(merkleAgent, msg)
+	sig, err := Sign(merkleAgent, msg)
 	if nil != err {
 		panic(err)
 	}
@@ -27,3 +27,26 @@ func ExampleVerify() {
 	fmt.Println(Verify(merkleAgent.Root, msg, sig))
 	// Output: true
 }
+
+func ExamplePublicKey_Verify() {
+	const H = 4
+	seed := make([]byte, lmots.N)
+	rand.Reader.Read(seed)
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		panic(err)
+	}
+
+	// the public key to distribute
+	pk := merkleAgent.PublicKey()
+
+	msg := make([]byte, lmots.N)
+	rand.Reader.Read(msg)
+	sig, err := Sign(merkleAgent, msg)
+	if nil != err {
+		panic(err)
+	}
+
+	fmt.Println(pk.Verify(msg, sig))
+	// Output: true
+}
@@ -0,0 +1,209 @@
+package lms
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// envelopeMagic leads every envelope of encrypted secret keys
+var envelopeMagic = []byte("LMSK")
+
+// envelopeVersion is the version of the envelope format
+const envelopeVersion = 1
+
+// ways to derive the key encrypting the secret data in envelopes
+const (
+	kdfArgon2id byte = 1 // key derived from a passphrase by Argon2id
+	kdfKEK      byte = 2 // key encryption key given directly
+)
+
+// Argon2id parameters for new envelopes, and the bounds accepted
+// from envelopes on import, which are kept close to the defaults since
+// the cost is paid before the envelope is authenticated
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024 // in KiB
+	argon2Threads = 4
+
+	maxArgon2Time   = 2 * argon2Time
+	maxArgon2Memory = 2 * argon2Memory
+)
+
+const (
+	lenSalt  = 16
+	lenKEK   = 32 // AES-256
+	lenNonce = 12
+)
+
+// ExportEncryptedSecretKey exports the agent as its public tree data
+// given by Serialize and an envelope of the secret data given by
+// SerializeSecretKey, which is encrypted by AES-256-GCM under a key
+// derived from the passphrase by Argon2id. The envelope authenticates
+// the public data, so both shall be imported together
+func (agent *MerkleAgent) ExportEncryptedSecretKey(passphrase []byte) (public []byte, envelope []byte, err error) {
+	salt := make([]byte, lenSalt)
+	if _, err := io.ReadFull(rand.Reader, salt); nil != err {
+		return nil, nil, err
+	}
+
+	header := append([]byte{}, envelopeMagic...)
+	header = append(header, envelopeVersion, kdfArgon2id)
+	header = append(header, u32str(argon2Time)...)
+	header = append(header, u32str(argon2Memory)...)
+	header = append(header, argon2Threads)
+	header = append(header, salt...)
+
+	key := argon2.IDKey(passphrase, salt, argon2Time, argon2Memory, argon2Threads, lenKEK)
+	defer wipe(key)
+
+	return agent.seal(header, key)
+}
+
+// ImportEncryptedSecretKey restores the agent as Rebuild from the
+// public data and envelope made by ExportEncryptedSecretKey.
+// ErrDecryption is returned if the passphrase is wrong, or either
+// of them is tampered with or mismatches the other
+func (agent *MerkleAgent) ImportEncryptedSecretKey(public, envelope, passphrase []byte) error {
+	header, rest, err := parseEnvelopeHeader(envelope, kdfArgon2id)
+	if nil != err {
+		return err
+	}
+
+	t := binary.BigEndian.Uint32(header[6:])
+	m := binary.BigEndian.Uint32(header[10:])
+	p := header[14]
+	if (0 == t) || (t > maxArgon2Time) || (0 == m) || (m > maxArgon2Memory) || (0 == p) {
+		return ErrUnsupportedEnvelope
+	}
+
+	key := argon2.IDKey(passphrase, header[15:], t, m, p, lenKEK)
+	defer wipe(key)
+
+	return agent.open(public, header, rest, key)
+}
+
+// ExportWrappedSecretKey works as ExportEncryptedSecretKey, but
+// encrypts the secret data under the 32-byte key encryption key
+// directly, which is supposed to be managed by a KMS or HSM
+func (agent *MerkleAgent) ExportWrappedSecretKey(kek []byte) (public []byte, envelope []byte, err error) {
+	if len(kek) != lenKEK {
+		return nil, nil, ErrInvalidLength
+	}
+
+	header := append([]byte{}, envelopeMagic...)
+	header = append(header, envelopeVersion, kdfKEK)
+
+	return agent.seal(header, kek)
+}
+
+// ImportWrappedSecretKey restores the agent from the public data and
+// envelope made by ExportWrappedSecretKey under the same key
+func (agent *MerkleAgent) ImportWrappedSecretKey(public, envelope, kek []byte) error {
+	if len(kek) != lenKEK {
+		return ErrInvalidLength
+	}
+
+	header, rest, err := parseEnvelopeHeader(envelope, kdfKEK)
+	if nil != err {
+		return err
+	}
+
+	return agent.open(public, header, rest, kek)
+}
+
+// seal serializes the agent, and encrypts the secret data under key
+// into the envelope `header|nonce|ciphertext`, where both the header
+// and digest of the public data are authenticated
+func (agent *MerkleAgent) seal(header, key []byte) ([]byte, []byte, error) {
+	aead, err := newAEAD(key)
+	if nil != err {
+		return nil, nil, err
+	}
+
+	// the public and secret data shall be of the same state
+	agent.mu.Lock()
+	public, err := agent.serialize()
+	secret, _ := agent.keyItr.Serialize()
+	agent.mu.Unlock()
+	if nil != err {
+		return nil, nil, err
+	}
+	defer wipe(secret)
+
+	nonce := make([]byte, lenNonce)
+	if _, err := io.ReadFull(rand.Reader, nonce); nil != err {
+		return nil, nil, err
+	}
+
+	envelope := append(header, nonce...)
+	envelope = aead.Seal(envelope, nonce, secret, envelopeAD(header, public))
+
+	return public, envelope, nil
+}
+
+// open decrypts the secret data from rest, i.e., `nonce|ciphertext`
+// following the header, and rebuilds the agent
+func (agent *MerkleAgent) open(public, header, rest, key []byte) error {
+	aead, err := newAEAD(key)
+	if nil != err {
+		return err
+	}
+
+	if len(rest) < lenNonce+aead.Overhead() {
+		return ErrInvalidLength
+	}
+
+	secret, err := aead.Open(nil, rest[:lenNonce], rest[lenNonce:], envelopeAD(header, public))
+	if nil != err {
+		return ErrDecryption
+	}
+	defer wipe(secret)
+
+	return agent.Rebuild(public, secret)
+}
+
+// parseEnvelopeHeader splits the envelope into the header and the rest,
+// where the header shall be of the current version and given kdf
+func parseEnvelopeHeader(envelope []byte, kdf byte) ([]byte, []byte, error) {
+	lenHeader := len(envelopeMagic) + 2
+	if (len(envelope) < lenHeader) || !bytes.Equal(envelope[:len(envelopeMagic)], envelopeMagic) ||
+		(envelopeVersion != envelope[len(envelopeMagic)]) {
+		return nil, nil, ErrUnsupportedEnvelope
+	}
+	if kdf != envelope[len(envelopeMagic)+1] {
+		return nil, nil, ErrUnsupportedEnvelope
+	}
+
+	if kdfArgon2id == kdf {
+		// t|m|p|salt
+		lenHeader += 9 + lenSalt
+	}
+	if len(envelope) < lenHeader {
+		return nil, nil, ErrInvalidLength
+	}
+
+	return envelope[:lenHeader], envelope[lenHeader:], nil
+}
+
+// envelopeAD makes the associated data `header|SHA-256(public)`
+func envelopeAD(header, public []byte) []byte {
+	digest := sha256.Sum256(public)
+	return append(append([]byte{}, header...), digest[:]...)
+}
+
+// newAEAD makes AES-256-GCM under the key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if nil != err {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,145 @@
+package lms
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+
+	"github.com/LoCCS/lmots"
+)
+
+func TestEncryptedSecretKey(t *testing.T) {
+	const H = 4
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err := Sign(merkleAgent, seed); nil != err {
+		t.Fatal(err)
+	}
+
+	passphrase := []byte("correct horse battery staple")
+	public, envelope, err := merkleAgent.ExportEncryptedSecretKey(passphrase)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// the secret data isn't left in plaintext
+	if bytes.Contains(envelope, merkleAgent.keyItr.seed) {
+		t.Fatal("seed is found in the envelope")
+	}
+
+	restored := new(MerkleAgent)
+	if err := restored.ImportEncryptedSecretKey(public, envelope, passphrase); nil != err {
+		t.Fatal(err)
+	}
+	if (restored.LeafIdx() != merkleAgent.LeafIdx()) || !bytes.Equal(restored.Root, merkleAgent.Root) {
+		t.Fatal("restored agent mismatches the exported one")
+	}
+
+	msg := []byte("hello world")
+	sig, err := Sign(restored, msg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !merkleAgent.PublicKey().Verify(msg, sig) {
+		t.Fatal("verification failed")
+	}
+
+	// public data of another state
+	if _, err := Sign(merkleAgent, msg); nil != err {
+		t.Fatal(err)
+	}
+	public2, err := merkleAgent.Serialize()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	tamperedPublic := append([]byte{}, public...)
+	tamperedPublic[len(tamperedPublic)/2] ^= 0x01
+	tamperedEnvelope := append([]byte{}, envelope...)
+	tamperedEnvelope[len(tamperedEnvelope)-1] ^= 0x01
+	tamperedHeader := append([]byte{}, envelope...)
+	tamperedHeader[len(envelopeMagic)+11] ^= 0x01 // salt
+	costlyTime := append([]byte{}, envelope...)
+	binary.BigEndian.PutUint32(costlyTime[len(envelopeMagic)+2:], maxArgon2Time+1)
+	costlyMemory := append([]byte{}, envelope...)
+	binary.BigEndian.PutUint32(costlyMemory[len(envelopeMagic)+6:], maxArgon2Memory+1)
+
+	testCases := []struct {
+		name                         string
+		public, envelope, passphrase []byte
+		want                         error
+	}{
+		{"wrong passphrase", public, envelope, []byte("wrong"), ErrDecryption},
+		{"tampered public data", tamperedPublic, envelope, passphrase, ErrDecryption},
+		{"mismatched public data", public2, envelope, passphrase, ErrDecryption},
+		{"tampered ciphertext", public, tamperedEnvelope, passphrase, ErrDecryption},
+		{"tampered salt", public, tamperedHeader, passphrase, ErrDecryption},
+		{"unknown version", public, append([]byte("LMSK\x02"), envelope[5:]...), passphrase, ErrUnsupportedEnvelope},
+		{"truncated envelope", public, envelope[:10], passphrase, ErrInvalidLength},
+		{"costly passes", public, costlyTime, passphrase, ErrUnsupportedEnvelope},
+		{"costly memory", public, costlyMemory, passphrase, ErrUnsupportedEnvelope},
+	}
+	for _, c := range testCases {
+		if err := new(MerkleAgent).ImportEncryptedSecretKey(c.public, c.envelope, c.passphrase); c.want != err {
+			t.Fatalf("%s: want %v, got %v", c.name, c.want, err)
+		}
+	}
+}
+
+func TestWrappedSecretKey(t *testing.T) {
+	const H = 3
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	merkleAgent, err := NewBoundedMerkleAgent(privateTypecode(H), seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	kek := make([]byte, 32)
+	if _, err := rand.Read(kek); nil != err {
+		t.Fatal(err)
+	}
+
+	public, envelope, err := merkleAgent.ExportWrappedSecretKey(kek)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	restored := new(MerkleAgent)
+	if err := restored.ImportWrappedSecretKey(public, envelope, kek); nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored.Root, merkleAgent.Root) {
+		t.Fatal("restored agent mismatches the exported one")
+	}
+
+	// envelopes of passphrases aren't opened by KEKs
+	_, envelope2, err := merkleAgent.ExportEncryptedSecretKey(kek)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := restored.ImportWrappedSecretKey(public, envelope2, kek); ErrUnsupportedEnvelope != err {
+		t.Fatalf("want %v, got %v", ErrUnsupportedEnvelope, err)
+	}
+
+	kek[0] ^= 0x01
+	if err := restored.ImportWrappedSecretKey(public, envelope, kek); ErrDecryption != err {
+		t.Fatalf("want %v, got %v", ErrDecryption, err)
+	}
+	if err := restored.ImportWrappedSecretKey(public, envelope, kek[:16]); ErrInvalidLength != err {
+		t.Fatalf("want %v, got %v", ErrInvalidLength, err)
+	}
+}
@@ -0,0 +1,217 @@
+package lms
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/LoCCS/lmots"
+)
+
+// fuzzFixture makes an agent of the SHA-256 tree of height 5 with a
+// fixed seed and signs msg, returning the public key and signature
+func fuzzFixture(f *testing.F, msg []byte) (*PublicKey, *MerkleSig) {
+	seed := make([]byte, lmots.N)
+	I := make([]byte, lenI)
+	merkleAgent, err := NewMerkleAgentWithOptions(seed, &AgentOpts{Typecode: LMS_SHA256_M32_H5, I: I})
+	if nil != err {
+		f.Fatal(err)
+	}
+
+	sig, err := SignWithOpts(merkleAgent, msg, &SignOpts{Deterministic: true})
+	if nil != err {
+		f.Fatal(err)
+	}
+
+	return merkleAgent.PublicKey(), sig
+}
+
+func FuzzVerify(f *testing.F) {
+	msg := []byte("fuzz me")
+	pk, sig := fuzzFixture(f, msg)
+
+	sigData, err := sig.MarshalBinary()
+	if nil != err {
+		f.Fatal(err)
+	}
+	f.Add(sigData, msg)
+	f.Add(sigData[:len(sigData)-1], msg)
+	f.Add(sigData, []byte("fuzz you"))
+	f.Add([]byte{}, []byte{})
+
+	// flip the leaf index and typecodes
+	for _, offset := range []int{3, 7, 8 + (1+67)*lmots.N + 3} {
+		if offset < len(sigData) {
+			bad := append([]byte{}, sigData...)
+			bad[offset] ^= 0x01
+			f.Add(bad, msg)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, m []byte) {
+		merkleSig := new(MerkleSig)
+		if nil != merkleSig.UnmarshalBinary(data) {
+			return
+		}
+
+		err := pk.VerifyWithError(m, merkleSig)
+		if (nil == err) && (!bytes.Equal(data, sigData) || !bytes.Equal(m, msg)) {
+			t.Fatalf("forged signature %x over %x passes verification", data, m)
+		}
+
+		// verification against the bare root doesn't panic either
+		merkleSig.Opts.I = sig.Opts.I
+		Verify(pk.Root, m, merkleSig)
+	})
+}
+
+func FuzzDeserializeSig(f *testing.F) {
+	msg := []byte("fuzz me")
+	pk, sig := fuzzFixture(f, msg)
+
+	gobData, err := sig.Serialize()
+	if nil != err {
+		f.Fatal(err)
+	}
+	f.Add(gobData)
+	f.Add(gobData[:len(gobData)/2])
+	f.Add([]byte{})
+
+	// signatures with components missing or of invalid length
+	truncated := *sig
+	truncated.Auth = sig.Auth[:len(sig.Auth)-1]
+	shortNode := *sig
+	shortNode.Auth = append([][]byte{sig.Auth[0][:1]}, sig.Auth[1:]...)
+	outOfRange := *sig
+	outOfRange.Opts = sig.Opts.Clone()
+	outOfRange.Opts.KeyIdx = 1 << 5
+	for _, bad := range []*MerkleSig{&truncated, &shortNode, &outOfRange, {Opts: sig.Opts}} {
+		data, err := bad.Serialize()
+		if nil != err {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		merkleSig := new(MerkleSig)
+		if nil != merkleSig.Deserialize(data) {
+			return
+		}
+
+		// any signature accepted by Deserialize is safe to verify
+		Verify(pk.Root, msg, merkleSig)
+		pk.Verify(msg, merkleSig)
+
+		if _, err := merkleSig.MarshalBinary(); nil != err {
+			t.Fatalf("deserialized signature can't be encoded: %v", err)
+		}
+	})
+}
+
+// hssFuzzFixture makes a HSS of two levels with a fixed seed and signs
+// msg, returning the public key and encoded signature
+func hssFuzzFixture(f *testing.F, msg []byte) (*HSSPublicKey, []byte) {
+	hss, err := NewHSS([]uint32{2, 2}, make([]byte, lmots.N))
+	if nil != err {
+		f.Fatal(err)
+	}
+
+	sig, err := hss.Sign(msg)
+	if nil != err {
+		f.Fatal(err)
+	}
+	sigData, err := sig.MarshalBinary()
+	if nil != err {
+		f.Fatal(err)
+	}
+
+	return hss.PublicKey(), sigData
+}
+
+func FuzzHSSSig(f *testing.F) {
+	msg := []byte("fuzz me")
+	pk, sigData := hssFuzzFixture(f, msg)
+
+	f.Add(sigData, msg)
+	f.Add(sigData[:len(sigData)-1], msg)
+	f.Add(sigData, []byte("fuzz you"))
+	f.Add([]byte{}, []byte{})
+	// Nspk wrapping around or beyond MaxLevels
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff}, msg)
+	f.Add(append([]byte{0x00, 0x00, 0x00, MaxLevels}, sigData[4:]...), msg)
+
+	f.Fuzz(func(t *testing.T, data []byte, m []byte) {
+		hssSig := new(HSSSig)
+		if nil != hssSig.UnmarshalBinary(data) {
+			return
+		}
+
+		err := pk.VerifyWithError(m, hssSig)
+		if (nil == err) && (!bytes.Equal(data, sigData) || !bytes.Equal(m, msg)) {
+			t.Fatalf("forged signature %x over %x passes verification", data, m)
+		}
+
+		if _, err := hssSig.MarshalBinary(); nil != err {
+			t.Fatalf("decoded signature can't be encoded: %v", err)
+		}
+	})
+}
+
+func FuzzHSSPublicKey(f *testing.F) {
+	msg := []byte("fuzz me")
+	pk, sigData := hssFuzzFixture(f, msg)
+
+	pkData, err := pk.MarshalBinary()
+	if nil != err {
+		f.Fatal(err)
+	}
+	f.Add(pkData)
+	f.Add(pkData[:len(pkData)-1])
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{})
+
+	sig := new(HSSSig)
+	if err := sig.UnmarshalBinary(sigData); nil != err {
+		f.Fatal(err)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		key := new(HSSPublicKey)
+		if nil != key.UnmarshalBinary(data) {
+			return
+		}
+
+		// any key accepted by UnmarshalBinary is safe to verify against
+		if err := key.VerifyWithError(msg, sig); (nil == err) && !bytes.Equal(data, pkData) {
+			t.Fatalf("signature verifies under another key %x", data)
+		}
+	})
+}
+
+func FuzzHSSRebuild(f *testing.F) {
+	hss, err := NewHSS([]uint32{2, 2}, make([]byte, lmots.N))
+	if nil != err {
+		f.Fatal(err)
+	}
+	data, err := hss.Serialize()
+	if nil != err {
+		f.Fatal(err)
+	}
+	secret := hss.SerializeSecretKey()
+
+	f.Add(data, secret)
+	f.Add(data[:len(data)/2], secret)
+	f.Add(data, secret[:len(secret)/2])
+	f.Add([]byte{}, []byte{})
+
+	msg := []byte("fuzz me")
+	f.Fuzz(func(t *testing.T, data []byte, secret []byte) {
+		restored := new(HSS)
+		if nil != restored.Rebuild(data, secret) {
+			return
+		}
+
+		// any HSS accepted by Rebuild is safe to sign with
+		restored.Sign(msg)
+	})
+}
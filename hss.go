@@ -0,0 +1,513 @@
+package lms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"sync"
+)
+
+// MaxLevels is the maximum number of levels of HSS allowed by RFC 8554
+const MaxLevels = 8
+
+// minSignedPubKeyLen is the least length of an encoded signed public
+// key, i.e., `u32str(q)|otstype|lms_type` of the signature followed by
+// `lms_type|otstype|I` of the public key
+const minSignedPubKeyLen = 12 + 8 + lenI
+
+// HSS implements the Hierarchical Signature System of RFC 8554 as
+// L levels of Merkle agents, where the root of each tree is signed
+// by the tree on its parent level. Trees on lower levels are
+// regenerated once exhausted. It is safe for concurrent use
+type HSS struct {
+	mu sync.Mutex // guards the state below
+
+	seed          []byte         // master seed deriving seeds of trees on all levels
+	typecodes     []uint32       // LMS typecodes of trees on each level
+	agents        []*MerkleAgent // agents[0] is the top-level tree
+	signedPubKeys []*MerkleSig   // signedPubKeys[i] signs the public key of agents[i+1]
+	generations   []uint32       // number of trees ever built on each level
+	store         StateStore     // durable record of leaves used, if any
+}
+
+// HSSPublicKey is the public key of HSS, which is made up of
+// the number of levels and public key of the top-level tree
+type HSSPublicKey struct {
+	Levels    uint32
+	PublicKey *PublicKey
+}
+
+// SignedPublicKey is the public key of a tree signed by
+// the tree on its parent level
+type SignedPublicKey struct {
+	Sig       *MerkleSig
+	PublicKey *PublicKey
+}
+
+// HSSSig is the container for the signature generated by HSS,
+// i.e., the chain of signed public keys from the top-level tree
+// followed by the signature of the bottom-level tree
+type HSSSig struct {
+	SignedPubKeys []*SignedPublicKey
+	Sig           *MerkleSig
+}
+
+// NewHSS makes a HSS signer with trees of the given heights from
+// the top level to the bottom level, which are built as NewMerkleAgent
+func NewHSS(heights []uint32, seed []byte) (*HSS, error) {
+	typecodes := make([]uint32, len(heights))
+	for i, H := range heights {
+		if H < 2 {
+			return nil, ErrInvalidHeight
+		}
+		typecodes[i] = privateTypecode(H)
+	}
+
+	return NewHSSWithTypecodes(typecodes, seed)
+}
+
+// NewHSSWithTypecodes makes a HSS signer with trees of the parameter
+// sets specified by LMS typecodes from the top level to the bottom level
+func NewHSSWithTypecodes(typecodes []uint32, seed []byte) (*HSS, error) {
+	L := len(typecodes)
+	if (L < 1) || (L > MaxLevels) {
+		return nil, ErrInvalidLevels
+	}
+
+	hss := &HSS{
+		seed:          make([]byte, len(seed)),
+		typecodes:     make([]uint32, L),
+		agents:        make([]*MerkleAgent, L),
+		signedPubKeys: make([]*MerkleSig, L-1),
+		generations:   make([]uint32, L),
+	}
+	copy(hss.seed, seed)
+	copy(hss.typecodes, typecodes)
+
+	for i := range hss.agents {
+		if err := hss.regenerate(i); nil != err {
+			return nil, err
+		}
+	}
+
+	return hss, nil
+}
+
+// deriveSeed estimates the seed for the next tree on level i
+// as `H(seed|u32str(i)|u32str(generation))`
+func (hss *HSS) deriveSeed(i int) []byte {
+	sh := HashFunc()
+
+	sh.Write(hss.seed)
+	sh.Write(u32str(uint32(i)))
+	sh.Write(u32str(hss.generations[i]))
+
+	return sh.Sum(nil)
+}
+
+// regenerate builds a fresh tree on level i, and signs its
+// public key by the tree on the parent level
+func (hss *HSS) regenerate(i int) error {
+	agent, err := NewMerkleAgentWithTypecode(hss.typecodes[i], hss.deriveSeed(i))
+	if nil != err {
+		return err
+	}
+	hss.generations[i]++
+
+	if i > 0 {
+		pkData, err := agent.PublicKey().MarshalBinary()
+		if nil != err {
+			return err
+		}
+
+		sig, err := Sign(hss.agents[i-1], pkData)
+		if nil != err {
+			return err
+		}
+		hss.signedPubKeys[i-1] = sig
+	}
+	hss.agents[i] = agent
+
+	return nil
+}
+
+// Sign produces a HSS signature by the bottom-level tree, where
+// exhausted trees are regenerated in advance
+func (hss *HSS) Sign(hash []byte) (*HSSSig, error) {
+	hss.mu.Lock()
+	defer hss.mu.Unlock()
+
+	if nil == hss.seed {
+		return nil, ErrDestroyed
+	}
+
+	L := len(hss.agents)
+
+	// the lowest level which has keys left
+	d := L - 1
+	for (d >= 0) && hss.agents[d].exhausted() {
+		d--
+	}
+	if d < 0 {
+		return nil, ErrOutOfKeys
+	}
+
+	if err := hss.reserve(d); nil != err {
+		return nil, err
+	}
+
+	for i := d + 1; i < L; i++ {
+		if err := hss.regenerate(i); nil != err {
+			return nil, err
+		}
+	}
+
+	sig, err := Sign(hss.agents[L-1], hash)
+	if nil != err {
+		return nil, err
+	}
+
+	hssSig := &HSSSig{
+		SignedPubKeys: make([]*SignedPublicKey, L-1),
+		Sig:           sig,
+	}
+	for i := range hssSig.SignedPubKeys {
+		hssSig.SignedPubKeys[i] = &SignedPublicKey{
+			Sig:       hss.signedPubKeys[i],
+			PublicKey: hss.agents[i+1].PublicKey(),
+		}
+	}
+
+	return hssSig, nil
+}
+
+// Exhausted checks if the HSS can give us more keys to use
+func (hss *HSS) Exhausted() bool {
+	hss.mu.Lock()
+	defer hss.mu.Unlock()
+
+	for _, agent := range hss.agents {
+		if !agent.exhausted() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// PublicKey returns the HSS public key
+func (hss *HSS) PublicKey() *HSSPublicKey {
+	hss.mu.Lock()
+	defer hss.mu.Unlock()
+
+	return &HSSPublicKey{
+		Levels:    uint32(len(hss.agents)),
+		PublicKey: hss.agents[0].PublicKey(),
+	}
+}
+
+// Verify checks the HSS signature over hash by walking down the
+// chain of signed public keys from the top-level tree
+func (pk *HSSPublicKey) Verify(hash []byte, hssSig *HSSSig) bool {
+	return nil == pk.VerifyWithError(hash, hssSig)
+}
+
+// VerifyWithError works as Verify, and returns the error of
+// PublicKey.VerifyWithError on the first level failing
+func (pk *HSSPublicKey) VerifyWithError(hash []byte, hssSig *HSSSig) error {
+	if (nil == hssSig) || (uint32(len(hssSig.SignedPubKeys))+1 != pk.Levels) {
+		return ErrMalformedSig
+	}
+
+	key := pk.PublicKey
+	for _, signedPk := range hssSig.SignedPubKeys {
+		if (nil == signedPk) || (nil == signedPk.PublicKey) {
+			return ErrMalformedSig
+		}
+
+		pkData, err := signedPk.PublicKey.MarshalBinary()
+		if nil != err {
+			return err
+		}
+		if err := key.VerifyWithError(pkData, signedPk.Sig); nil != err {
+			return err
+		}
+
+		key = signedPk.PublicKey
+	}
+
+	return key.VerifyWithError(hash, hssSig.Sig)
+}
+
+// MarshalBinary encodes the HSS public key as `u32str(L)|pub[0]`
+// according to RFC 8554
+func (pk *HSSPublicKey) MarshalBinary() ([]byte, error) {
+	if (pk.Levels < 1) || (pk.Levels > MaxLevels) {
+		return nil, ErrInvalidLevels
+	}
+	if nil == pk.PublicKey {
+		return nil, ErrMalformedPubKey
+	}
+
+	pkData, err := pk.PublicKey.MarshalBinary()
+	if nil != err {
+		return nil, err
+	}
+
+	return append(u32str(pk.Levels), pkData...), nil
+}
+
+// UnmarshalBinary decodes the HSS public key from the RFC 8554 encoding
+func (pk *HSSPublicKey) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return ErrInvalidLength
+	}
+
+	L := binary.BigEndian.Uint32(data)
+	if (L < 1) || (L > MaxLevels) {
+		return ErrInvalidLevels
+	}
+
+	key := new(PublicKey)
+	if err := key.UnmarshalBinary(data[4:]); nil != err {
+		return err
+	}
+
+	pk.Levels, pk.PublicKey = L, key
+
+	return nil
+}
+
+// MarshalBinary encodes the HSS signature as
+// `u32str(Nspk)|signed_pub_key[0]|...|signed_pub_key[Nspk-1]|sig[Nspk]`
+// according to RFC 8554, where `signed_pub_key[i]=sig[i]|pub[i+1]`
+func (hssSig *HSSSig) MarshalBinary() ([]byte, error) {
+	if (nil == hssSig.Sig) || (len(hssSig.SignedPubKeys)+1 > MaxLevels) {
+		return nil, ErrMalformedSig
+	}
+
+	data := u32str(uint32(len(hssSig.SignedPubKeys)))
+	for _, signedPk := range hssSig.SignedPubKeys {
+		if (nil == signedPk) || (nil == signedPk.Sig) || (nil == signedPk.PublicKey) {
+			return nil, ErrMalformedSig
+		}
+
+		sigData, err := signedPk.Sig.MarshalBinary()
+		if nil != err {
+			return nil, err
+		}
+		pkData, err := signedPk.PublicKey.MarshalBinary()
+		if nil != err {
+			return nil, err
+		}
+
+		data = append(data, sigData...)
+		data = append(data, pkData...)
+	}
+
+	sigData, err := hssSig.Sig.MarshalBinary()
+	if nil != err {
+		return nil, err
+	}
+
+	return append(data, sigData...), nil
+}
+
+// UnmarshalBinary decodes the HSS signature from the RFC 8554 encoding
+func (hssSig *HSSSig) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return ErrInvalidLength
+	}
+
+	// compared without arithmetic, which would wrap around in uint32
+	Nspk := binary.BigEndian.Uint32(data)
+	if Nspk >= MaxLevels {
+		return ErrInvalidLevels
+	}
+	data = data[4:]
+	if int(Nspk)*minSignedPubKeyLen > len(data) {
+		return ErrInvalidLength
+	}
+
+	signedPubKeys := make([]*SignedPublicKey, Nspk)
+	for i := range signedPubKeys {
+		signedPk := new(SignedPublicKey)
+
+		var err error
+		if signedPk.Sig, data, err = parseMerkleSig(data); nil != err {
+			return err
+		}
+		if signedPk.PublicKey, data, err = parsePublicKey(data); nil != err {
+			return err
+		}
+
+		signedPubKeys[i] = signedPk
+	}
+
+	sig := new(MerkleSig)
+	if err := sig.UnmarshalBinary(data); nil != err {
+		return err
+	}
+
+	hssSig.SignedPubKeys, hssSig.Sig = signedPubKeys, sig
+
+	return nil
+}
+
+type hssEx struct {
+	Typecodes     []uint32
+	Agents        [][]byte
+	SignedPubKeys [][]byte
+	Generations   []uint32
+}
+
+type hssSecretEx struct {
+	Seed   []byte
+	Agents [][]byte
+}
+
+// Serialize encodes all the information about the HSS
+// that can be stored as plaintext
+func (hss *HSS) Serialize() ([]byte, error) {
+	hss.mu.Lock()
+	defer hss.mu.Unlock()
+
+	hssGob := &hssEx{
+		Typecodes:     hss.typecodes,
+		Agents:        make([][]byte, len(hss.agents)),
+		SignedPubKeys: make([][]byte, len(hss.signedPubKeys)),
+		Generations:   hss.generations,
+	}
+
+	var err error
+	for i, agent := range hss.agents {
+		if hssGob.Agents[i], err = agent.Serialize(); nil != err {
+			return nil, err
+		}
+	}
+	for i, sig := range hss.signedPubKeys {
+		if hssGob.SignedPubKeys[i], err = sig.Serialize(); nil != err {
+			return nil, err
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(hssGob); nil != err {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// SerializeSecretKey encodes all the secret data which shall be encrypted
+func (hss *HSS) SerializeSecretKey() []byte {
+	hss.mu.Lock()
+	defer hss.mu.Unlock()
+
+	secretGob := &hssSecretEx{
+		Seed:   hss.seed,
+		Agents: make([][]byte, len(hss.agents)),
+	}
+	for i, agent := range hss.agents {
+		secretGob.Agents[i] = agent.SerializeSecretKey()
+		defer wipe(secretGob.Agents[i])
+	}
+
+	buf := new(bytes.Buffer)
+	gob.NewEncoder(buf).Encode(secretGob)
+
+	return buf.Bytes()
+}
+
+// Close wipes the master seed and secret data of agents on all
+// levels, after which signing fails with ErrDestroyed
+func (hss *HSS) Close() error {
+	hss.mu.Lock()
+	defer hss.mu.Unlock()
+
+	wipe(hss.seed)
+	hss.seed = nil
+
+	for _, agent := range hss.agents {
+		agent.Close()
+	}
+
+	return nil
+}
+
+// Rebuild restores the HSS from serialized bytes and secret bytes,
+// where the tree on each level shall be of the recorded typecode and
+// have its public key signed by the tree on the parent level. A HSS
+// bound to a store is moved past the recorded state as SetStateStore.
+// The HSS is left untouched on failure
+func (hss *HSS) Rebuild(data []byte, secret []byte) error {
+	hss.mu.Lock()
+	defer hss.mu.Unlock()
+
+	hssGob := new(hssEx)
+	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(hssGob); nil != err {
+		return err
+	}
+
+	secretGob := new(hssSecretEx)
+	if err := gob.NewDecoder(bytes.NewBuffer(secret)).Decode(secretGob); nil != err {
+		return err
+	}
+
+	L := len(hssGob.Typecodes)
+	if (L < 1) || (L > MaxLevels) {
+		return ErrInvalidLevels
+	}
+	if (len(hssGob.Agents) != L) || (len(secretGob.Agents) != L) ||
+		(len(hssGob.SignedPubKeys) != L-1) || (len(hssGob.Generations) != L) {
+		return ErrInvalidLength
+	}
+
+	agents := make([]*MerkleAgent, L)
+	for i := range agents {
+		agents[i] = new(MerkleAgent)
+		if err := agents[i].Rebuild(hssGob.Agents[i], secretGob.Agents[i]); nil != err {
+			return err
+		}
+		if (agents[i].params.Typecode != hssGob.Typecodes[i]) || (0 == hssGob.Generations[i]) {
+			return ErrInvalidState
+		}
+	}
+
+	signedPubKeys := make([]*MerkleSig, L-1)
+	for i := range signedPubKeys {
+		signedPubKeys[i] = new(MerkleSig)
+		if err := signedPubKeys[i].Deserialize(hssGob.SignedPubKeys[i]); nil != err {
+			return err
+		}
+
+		pkData, err := agents[i+1].PublicKey().MarshalBinary()
+		if nil != err {
+			return err
+		}
+		if !agents[i].PublicKey().Verify(pkData, signedPubKeys[i]) {
+			return ErrInvalidState
+		}
+	}
+
+	restored := &HSS{
+		seed:          secretGob.Seed,
+		typecodes:     hssGob.Typecodes,
+		agents:        agents,
+		signedPubKeys: signedPubKeys,
+		generations:   hssGob.Generations,
+	}
+	if nil != hss.store {
+		if err := restored.bindStateStore(hss.store); nil != err {
+			return err
+		}
+	}
+
+	hss.seed = restored.seed
+	hss.typecodes = restored.typecodes
+	hss.agents = restored.agents
+	hss.signedPubKeys = restored.signedPubKeys
+	hss.generations = restored.generations
+
+	return nil
+}
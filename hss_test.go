@@ -0,0 +1,301 @@
+package lms
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/LoCCS/lmots"
+)
+
+func TestHSS(t *testing.T) {
+	heights := []uint32{2, 2}
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	hss, err := NewHSS(heights, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pk := hss.PublicKey()
+
+	msg := make([]byte, lmots.N)
+	if _, err := rand.Read(msg); nil != err {
+		t.Fatal(err)
+	}
+
+	// all trees on the lower level are exhausted in turn
+	for i := 0; i < 1<<(heights[0]+heights[1]); i++ {
+		sig, err := hss.Sign(msg)
+		if nil != err {
+			t.Fatalf("error in signing with the %vth key: %s", i, err)
+		}
+
+		if !pk.Verify(msg, sig) {
+			t.Fatalf("verification failed for the %vth key", i)
+		}
+	}
+
+	if !hss.Exhausted() {
+		t.Fatal("HSS should have been exhausted")
+	}
+	if _, err := hss.Sign(msg); ErrOutOfKeys != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrOutOfKeys, err)
+	}
+}
+
+func TestHSSBinaryEncoding(t *testing.T) {
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	hss, err := NewHSS([]uint32{2, 3, 2}, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	msg := make([]byte, lmots.N)
+	if _, err := rand.Read(msg); nil != err {
+		t.Fatal(err)
+	}
+
+	sig, err := hss.Sign(msg)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	pkData, err := hss.PublicKey().MarshalBinary()
+	if nil != err {
+		t.Fatal(err)
+	}
+	sigData, err := sig.MarshalBinary()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	pk := new(HSSPublicKey)
+	if err := pk.UnmarshalBinary(pkData); nil != err {
+		t.Fatal(err)
+	}
+	sig2 := new(HSSSig)
+	if err := sig2.UnmarshalBinary(sigData); nil != err {
+		t.Fatal(err)
+	}
+
+	if !pk.Verify(msg, sig2) {
+		t.Fatal("verification failed")
+	}
+
+	if err := sig2.UnmarshalBinary(sigData[:len(sigData)-1]); nil == err {
+		t.Fatal("expect error for truncated signature")
+	}
+	if err := pk.UnmarshalBinary(append(pkData, 0x00)); nil == err {
+		t.Fatal("expect error for extended public key")
+	}
+
+	// counts of signed public keys wrapping around or beyond the data
+	for _, data := range [][]byte{
+		{0xff, 0xff, 0xff, 0xff},
+		{0x00, 0x00, 0x00, 0x07},
+		append([]byte{0x00, 0x00, 0x00, 0x03}, sigData[4:]...),
+	} {
+		if err := sig2.UnmarshalBinary(data); nil == err {
+			t.Fatalf("expect error for Nspk of %x", data[:4])
+		}
+	}
+}
+
+func TestHSSRebuild(t *testing.T) {
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	hss, err := NewHSS([]uint32{2, 2}, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pk := hss.PublicKey()
+
+	msg := make([]byte, lmots.N)
+	if _, err := rand.Read(msg); nil != err {
+		t.Fatal(err)
+	}
+
+	// exhaust the first tree on the lower level
+	for i := 0; i < 4; i++ {
+		if _, err := hss.Sign(msg); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := hss.Serialize()
+	if nil != err {
+		t.Fatal(err)
+	}
+	secret := hss.SerializeSecretKey()
+
+	hss2 := new(HSS)
+	if err := hss2.Rebuild(data, secret); nil != err {
+		t.Fatal(err)
+	}
+
+	sig, err := hss2.Sign(msg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !pk.Verify(msg, sig) {
+		t.Fatal("verification failed")
+	}
+	if 1 != sig.SignedPubKeys[0].Sig.Opts.KeyIdx {
+		t.Fatalf("invalid index of the upper tree: want 1, got %v",
+			sig.SignedPubKeys[0].Sig.Opts.KeyIdx)
+	}
+}
+
+func TestHSSRebuildMismatch(t *testing.T) {
+	newState := func() (*hssEx, []byte) {
+		seed := make([]byte, lmots.N)
+		if _, err := rand.Read(seed); nil != err {
+			t.Fatal(err)
+		}
+
+		hss, err := NewHSS([]uint32{2, 2}, seed)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		data, err := hss.Serialize()
+		if nil != err {
+			t.Fatal(err)
+		}
+		hssGob := new(hssEx)
+		if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(hssGob); nil != err {
+			t.Fatal(err)
+		}
+
+		return hssGob, hss.SerializeSecretKey()
+	}
+
+	encode := func(hssGob *hssEx) []byte {
+		buf := new(bytes.Buffer)
+		if err := gob.NewEncoder(buf).Encode(hssGob); nil != err {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	hssGob, secret := newState()
+	other, _ := newState()
+
+	// public key of the lower tree signed by another HSS
+	signedPubKeys := hssGob.SignedPubKeys
+	hssGob.SignedPubKeys = other.SignedPubKeys
+	if err := new(HSS).Rebuild(encode(hssGob), secret); ErrInvalidState != err {
+		t.Fatalf("invalid error for foreign signed public key: want %v, got %v", ErrInvalidState, err)
+	}
+	hssGob.SignedPubKeys = signedPubKeys
+
+	// typecodes disagreeing with the trees
+	hssGob.Typecodes[1] = privateTypecode(3)
+	if err := new(HSS).Rebuild(encode(hssGob), secret); ErrInvalidState != err {
+		t.Fatalf("invalid error for mismatched typecode: want %v, got %v", ErrInvalidState, err)
+	}
+	hssGob.Typecodes[1] = privateTypecode(2)
+
+	if err := new(HSS).Rebuild(encode(hssGob), secret); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestHSSConcurrentSign(t *testing.T) {
+	const workers, perWorker = 8, 2
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	hss, err := NewHSS([]uint32{2, 2}, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pk := hss.PublicKey()
+
+	msg := []byte("concurrent HSS signing")
+
+	sigs := make(chan *HSSSig, workers*perWorker)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < perWorker; i++ {
+				sig, err := hss.Sign(msg)
+				if nil != err {
+					errs <- err
+					return
+				}
+				sigs <- sig
+			}
+		}()
+	}
+	wg.Wait()
+	close(sigs)
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// each signature is made by a distinct leaf of the lower trees
+	used := make(map[string]bool)
+	for sig := range sigs {
+		if !pk.Verify(msg, sig) {
+			t.Fatal("verification failed")
+		}
+
+		leaf := fmt.Sprintf("%x/%d", sig.SignedPubKeys[0].PublicKey.I, sig.Sig.Opts.KeyIdx)
+		if used[leaf] {
+			t.Fatalf("leaf %s is used twice", leaf)
+		}
+		used[leaf] = true
+	}
+
+	if !hss.Exhausted() {
+		t.Fatal("HSS should have been exhausted")
+	}
+}
+
+func TestHSSClose(t *testing.T) {
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	hss, err := NewHSS([]uint32{2, 2}, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	retainedSeed := hss.seed
+
+	if err := hss.Close(); nil != err {
+		t.Fatal(err)
+	}
+
+	if !isZero(retainedSeed) {
+		t.Fatal("seed isn't wiped")
+	}
+	if _, err := hss.Sign(seed); ErrDestroyed != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrDestroyed, err)
+	}
+}
@@ -0,0 +1,50 @@
+// Package atomicfile replaces files atomically, which is shared by
+// the state store of lms and the key files of the lms command
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile writes data into a temporary file in the same directory,
+// syncs it to disk and renames it as path, so that path holds either
+// the old or the new data after a crash
+func WriteFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	fd, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if nil != err {
+		return err
+	}
+	tmpPath := fd.Name()
+
+	if _, err := fd.Write(data); nil != err {
+		fd.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := fd.Sync(); nil != err {
+		fd.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := fd.Close(); nil != err {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); nil != err {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// persist the renaming
+	dirFd, err := os.Open(dir)
+	if nil != err {
+		return err
+	}
+	defer dirFd.Close()
+
+	return dirFd.Sync()
+}
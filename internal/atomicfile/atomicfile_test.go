@@ -0,0 +1,45 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state")
+
+	for _, data := range []string{"old", "new"} {
+		if err := WriteFile(path, []byte(data)); nil != err {
+			t.Fatal(err)
+		}
+
+		got, err := ioutil.ReadFile(path)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if data != string(got) {
+			t.Fatalf("invalid content: want %q, got %q", data, got)
+		}
+	}
+
+	// no temporary file is left behind
+	files, err := ioutil.ReadDir(dir)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(files) {
+		t.Fatalf("want 1 file, got %d", len(files))
+	}
+
+	// the directory must exist
+	if err := WriteFile(filepath.Join(dir, "missing", "state"), nil); nil == err {
+		t.Fatal("file is written into a missing directory")
+	}
+}
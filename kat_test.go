@@ -0,0 +1,156 @@
+package lms
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// rfcVector is a test case of RFC 8554 Appendix F. Levels is the
+// number of HSS levels, where 0 stands for a single LMS tree. Seed and
+// I are the private key of the top-level tree if given, and Message
+// along with Signature may be absent for vectors of key generation
+type rfcVector struct {
+	Name      string   `json:"name"`
+	Levels    int      `json:"levels"`
+	PublicKey hexBytes `json:"publicKey"`
+	Message   hexBytes `json:"message"`
+	Signature hexBytes `json:"signature"`
+	Seed      hexBytes `json:"seed"`
+	I         hexBytes `json:"I"`
+}
+
+// loadVectors decodes every JSON file matching pattern into a value
+// made by newValue, and fails the test if none is found
+func loadVectors(t *testing.T, pattern string, newValue func() interface{}) []interface{} {
+	files, err := filepath.Glob(pattern)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 0 == len(files) {
+		t.Fatalf("no vectors matching %s, see testdata/README.md", pattern)
+	}
+
+	var values []interface{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		v := newValue()
+		if err := json.Unmarshal(data, v); nil != err {
+			t.Fatalf("%s: %v", file, err)
+		}
+		values = append(values, v)
+	}
+
+	return values
+}
+
+func TestRFC8554Vectors(t *testing.T) {
+	values := loadVectors(t, filepath.Join("testdata", "rfc8554", "*.json"),
+		func() interface{} { return new([]*rfcVector) })
+
+	for _, v := range values {
+		for _, vector := range *v.(*[]*rfcVector) {
+			vector := vector
+			t.Run(vector.Name, func(t *testing.T) {
+				testRFCVector(t, vector)
+			})
+		}
+	}
+}
+
+func testRFCVector(t *testing.T, vector *rfcVector) {
+	if (nil == vector.Signature) && (nil == vector.Seed) {
+		t.Fatal("neither signature nor seed is given")
+	}
+
+	var pk *PublicKey
+	var verify func(msg []byte) bool
+	if vector.Levels > 0 {
+		hssPk := new(HSSPublicKey)
+		if err := hssPk.UnmarshalBinary(vector.PublicKey); nil != err {
+			t.Fatal(err)
+		}
+		if int(hssPk.Levels) != vector.Levels {
+			t.Fatalf("invalid levels: want %d, got %d", vector.Levels, hssPk.Levels)
+		}
+		pk = hssPk.PublicKey
+
+		verify = func(msg []byte) bool {
+			hssSig := new(HSSSig)
+			if err := hssSig.UnmarshalBinary(vector.Signature); nil != err {
+				t.Fatal(err)
+			}
+			return hssPk.Verify(msg, hssSig)
+		}
+	} else {
+		pk = new(PublicKey)
+		if err := pk.UnmarshalBinary(vector.PublicKey); nil != err {
+			t.Fatal(err)
+		}
+
+		verify = func(msg []byte) bool {
+			sig := new(MerkleSig)
+			if err := sig.UnmarshalBinary(vector.Signature); nil != err {
+				t.Fatal(err)
+			}
+			return pk.Verify(msg, sig)
+		}
+	}
+
+	if nil != vector.Signature {
+		if !verify(vector.Message) {
+			t.Fatal("verification failed")
+		}
+		if verify(append([]byte{0x00}, vector.Message...)) {
+			t.Fatal("verification passes for another message")
+		}
+	}
+
+	if nil == vector.Seed {
+		return
+	}
+
+	// regenerate the top-level key from its seed and I
+	merkleAgent, err := NewMerkleAgentWithOptions(vector.Seed, &AgentOpts{
+		Typecode:    pk.Typecode,
+		OtsTypecode: pk.OtsTypecode,
+		I:           vector.I,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !pk.Equal(merkleAgent.PublicKey()) {
+		t.Fatalf("invalid public key: want %x, got %x", pk.Root, merkleAgent.Root)
+	}
+
+	if (vector.Levels > 0) || (nil == vector.Signature) {
+		return
+	}
+
+	// re-sign with the leaf and randomizer used by the vector
+	want := new(MerkleSig)
+	if err := want.UnmarshalBinary(vector.Signature); nil != err {
+		t.Fatal(err)
+	}
+	store := &memStateStore{state: &SigningState{I: vector.I, Next: want.Opts.KeyIdx}}
+	if err := merkleAgent.SetStateStore(store); nil != err {
+		t.Fatal(err)
+	}
+	sig, err := SignWithOpts(merkleAgent, vector.Message, &SignOpts{Rand: bytes.NewReader(want.LMSig.C)})
+	if nil != err {
+		t.Fatal(err)
+	}
+	sigData, err := sig.MarshalBinary()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sigData, vector.Signature) {
+		t.Fatalf("invalid signature: want %x, got %x", []byte(vector.Signature), sigData)
+	}
+}
@@ -1,7 +1,8 @@
 package lms
 
 import (
-	"bytes"
+	"crypto/subtle"
+	"io"
 
 	"github.com/LoCCS/lmots"
 	"github.com/LoCCS/lmots/rand"
@@ -13,29 +14,171 @@ type MerkleSig struct {
 	Opts  *lmots.LMOpts
 	LMSig *lmots.Sig // OTS signature
 
-	Auth [][]byte
+	Auth     [][]byte
+	Typecode uint32 // LMS typecode, where 0 stands for the SHA3-256 tree of height len(Auth)
 }
 
-// Sign produces a Merkle signature
-func Sign(agent *MerkleAgent, hash []byte) (*lmots.PrivateKey, *MerkleSig, error) {
-	merkleSig := new(MerkleSig)
+// paramSet returns the parameter set specified by the signature
+func (merkleSig *MerkleSig) paramSet() (*ParamSet, error) {
+	typecode := merkleSig.Typecode
+	if 0 == typecode {
+		typecode = privateTypecode(uint32(len(merkleSig.Auth)))
+	}
+
+	ps, err := LookupParamSet(typecode)
+	if nil != err {
+		return nil, err
+	}
+	if ps.H != uint32(len(merkleSig.Auth)) {
+		return nil, ErrAuthPathLength
+	}
+
+	return ps, nil
+}
+
+// validate checks that every component of the signature is present
+// and of the length specified by its parameter sets, which returns the
+// LMS parameter set if so
+func (merkleSig *MerkleSig) validate() (*ParamSet, error) {
+	if (nil == merkleSig.Opts) || (nil == merkleSig.LMSig) {
+		return nil, ErrMalformedSig
+	}
+
+	ps, err := merkleSig.paramSet()
+	if nil != err {
+		return nil, err
+	}
+
+	if (merkleSig.LMSig.Typecode != merkleSig.Opts.Typecode) ||
+		!ps.matchesOTS(otsTypecode(merkleSig.Opts)) {
+		return nil, ErrTypecodeMismatch
+	}
+	if merkleSig.Opts.KeyIdx >= (1 << ps.H) {
+		return nil, ErrIndexOutOfRange
+	}
+
+	params, err := lookupOTSParams(merkleSig.Opts)
+	if nil != err {
+		return nil, err
+	}
+	if err := checkOTSSig(params, merkleSig.Opts, merkleSig.LMSig); nil != err {
+		return nil, err
+	}
+
+	for _, node := range merkleSig.Auth {
+		if len(node) != ps.M {
+			return nil, ErrMalformedSig
+		}
+	}
+
+	return ps, nil
+}
+
+// Sign produces a Merkle signature. If the agent is bound to a
+// StateStore, the leaf is reserved durably before signing.
+// Concurrent calls on the same agent are serialized, each of
+// which is given a distinct leaf. The one-time private key of
+// the leaf is wiped once the signature is made
+func Sign(agent *MerkleAgent, hash []byte) (*MerkleSig, error) {
+	return SignWithOpts(agent, hash, nil)
+}
+
+// SignOpts specifies how the randomizer C of LM-OTS is drawn
+type SignOpts struct {
+	// Rand is the source of randomness, which defaults to rand.Reader of lmots
+	Rand io.Reader
+	// Deterministic derives C from the seed and leaf index as
+	//	`H(I|u32str(q)|u16str(0xfffd)|u8str(0xff)|SEED)`, overriding Rand
+	Deterministic bool
+}
+
+// SignWithOpts works as Sign with the randomizer drawn as specified
+// by opts, where a nil opts gives the behaviour of Sign. Deterministic
+// signing requires keys derived by their indexes, or ErrNotPositional
+// is returned
+func SignWithOpts(agent *MerkleAgent, hash []byte, opts *SignOpts) (*MerkleSig, error) {
+	sk, merkleSig, err := sign(agent, hash, opts)
+	if nil != sk {
+		agent.releaseKey(sk)
+	}
+
+	return merkleSig, err
+}
+
+// DebugSignWithKey works as Sign but also returns the one-time
+// private key of the leaf used, which is wiped on closing the agent.
+// It is meant for debugging and testing only, since the key must
+// never be kept or reused
+func DebugSignWithKey(agent *MerkleAgent, hash []byte) (*lmots.PrivateKey, *MerkleSig, error) {
+	return sign(agent, hash, nil)
+}
+
+// releaseKey wipes the one-time private key handed out by the key
+// iterator of the agent once used up
+func (agent *MerkleAgent) releaseKey(sk *lmots.PrivateKey) {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	agent.keyItr.release(sk)
+}
+
+// sign produces a Merkle signature together with the one-time
+// private key used
+func sign(agent *MerkleAgent, hash []byte, opts *SignOpts) (*lmots.PrivateKey, *MerkleSig, error) {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	var rng io.Reader = rand.Reader
+	if nil != opts {
+		if opts.Deterministic {
+			var err error
+			if rng, err = agent.keyItr.randomizer(agent.leafIdx()); nil != err {
+				return nil, nil, err
+			}
+		} else if nil != opts.Rand {
+			rng = opts.Rand
+		}
+	}
+
+	sk, merkleSig, err := agent.nextLeaf()
+	if nil != err {
+		return sk, nil, err
+	}
+
+	merkleSig.LMSig, err = otsSign(rng, sk, hash)
+	if nil != err {
+		return sk, nil, err
+	}
+
+	return sk, merkleSig, nil
+}
+
+// nextLeaf reserves and uses up the next leaf with agent.mu held, and
+// returns its key pair along with the Merkle signature carrying the
+// auth path, whose LM-OTS signature is left for the caller
+func (agent *MerkleAgent) nextLeaf() (*lmots.PrivateKey, *MerkleSig, error) {
+	if agent.keyItr.destroyed {
+		return nil, nil, ErrDestroyed
+	}
 
-	if agent.Exhausted() {
+	if agent.exhausted() {
 		return nil, nil, ErrOutOfKeys
 	}
 
-	sk, err := agent.keyItr.Next()
-	if err != nil {
+	if err := agent.reserve(); nil != err {
 		return nil, nil, err
 	}
 
-	merkleSig.LMSig, err = lmots.Sign(rand.Reader, sk, hash)
-	if nil != err {
+	sk, err := agent.keyItr.Next()
+	if err != nil {
 		return nil, nil, err
 	}
 
+	merkleSig := new(MerkleSig)
+
 	// fill in the public key deriving leaf
 	merkleSig.Opts = sk.PublicKey.Opts.Clone()
+	merkleSig.Typecode = agent.params.Typecode
 
 	// copy the auth path
 	merkleSig.Auth = make([][]byte, len(agent.auth))
@@ -45,39 +188,70 @@ func Sign(agent *MerkleAgent, hash []byte) (*lmots.PrivateKey, *MerkleSig, error
 	}
 
 	// update auth path
-	agent.Traverse()
+	if err := agent.traverse(); nil != err {
+		return sk, nil, err
+	}
 
 	return sk, merkleSig, nil
 }
 
 // Verify verifies a Merkle signature
 func Verify(root []byte, hash []byte, merkleSig *MerkleSig) bool {
-	leafPk := &lmots.PublicKey{
-		Opts: merkleSig.Opts,
+	return nil == VerifyWithError(root, hash, merkleSig)
+}
+
+// VerifyWithError verifies a Merkle signature, and tells why it fails
+// by errors like ErrIndexOutOfRange, ErrAuthPathLength,
+// ErrTypecodeMismatch, ErrMalformedSig and ErrRootMismatch
+func VerifyWithError(root []byte, hash []byte, merkleSig *MerkleSig) error {
+	if nil == merkleSig {
+		return ErrMalformedSig
 	}
 
-	{
-		var err error
-		if leafPk.K, err = lmots.RecoverK(merkleSig.Opts, hash, merkleSig.LMSig); nil != err {
-			return false
-		}
+	return verify(merkleSig.Opts, root, recoverK(hash), merkleSig)
+}
+
+// kRecoverer estimates the candidate LM-OTS public key from the
+// LM-OTS signature w.r.t opts
+type kRecoverer func(opts *lmots.LMOpts, lmSig *lmots.Sig) ([]byte, error)
+
+// recoverK returns the kRecoverer over hash
+func recoverK(hash []byte) kRecoverer {
+	return func(opts *lmots.LMOpts, lmSig *lmots.Sig) ([]byte, error) {
+		return otsRecoverK(opts, hash, lmSig)
+	}
+}
+
+// verify checks the Merkle signature against the root w.r.t the
+// LM-OTS options opts specifying the key pair ID I and leaf index,
+// where the LM-OTS public key of the leaf is estimated by recoverer
+func verify(opts *lmots.LMOpts, root []byte, recoverer kRecoverer, merkleSig *MerkleSig) error {
+	if nil == opts {
+		return ErrMalformedSig
 	}
 
-	H := len(merkleSig.Auth)
-	// index of node in current height h
-	idx := merkleSig.Opts.KeyIdx + (1 << uint32(H))
+	ps, err := merkleSig.validate()
+	if nil != err {
+		return err
+	}
 
-	parentHash := hashOTSPk(leafPk, uint32(H))
-	for h := 0; h < H; h++ {
-		// level up
-		if 1 == idx%2 {
-			parentHash = merge(leafPk.Opts.I[:], idx/2, merkleSig.Auth[h], parentHash)
-		} else {
-			parentHash = merge(leafPk.Opts.I[:], idx/2, parentHash, merkleSig.Auth[h])
-		}
+	// opts may be the clone of merkleSig.Opts with I filled in
+	if (opts.Typecode != merkleSig.Opts.Typecode) || (opts.KeyIdx != merkleSig.Opts.KeyIdx) {
+		return ErrMalformedSig
+	}
+
+	leafPk := &lmots.PublicKey{
+		Opts: opts,
+	}
+
+	if leafPk.K, err = recoverer(opts, merkleSig.LMSig); nil != err {
+		return err
+	}
 
-		idx = idx >> 1
+	parentHash := climb(ps, opts.I[:], opts.KeyIdx, hashOTSPk(ps, leafPk), merkleSig.Auth)
+	if 1 != subtle.ConstantTimeCompare(parentHash, root) {
+		return ErrRootMismatch
 	}
 
-	return bytes.Equal(parentHash, root)
+	return nil
 }
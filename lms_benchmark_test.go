@@ -19,6 +19,19 @@ func BenchmarkNewMerkleAgent(b *testing.B) {
 	}
 }
 
+func BenchmarkNewMerkleAgentParallel(b *testing.B) {
+	const H = 16
+	seed := make([]byte, lmots.N)
+	rand.Reader.Read(seed)
+
+	opts := &AgentOpts{Typecode: privateTypecode(H)}
+	for i := 0; i < b.N; i++ {
+		if _, err := NewMerkleAgentWithOptions(seed, opts); nil != err {
+			b.Fatalf("unexpected error in  NewMerkleAgentWithOptions(%x,%+v)", seed, opts)
+		}
+	}
+}
+
 func BenchmarkLMSStdOps(b *testing.B) {
 	const H = 16 // large to ensure (1<<H)>b.N
 	seed := make([]byte, lmots.N)
@@ -33,7 +46,7 @@ func BenchmarkLMSStdOps(b *testing.B) {
 	rand.Reader.Read(msg)
 	// what if no more leaf to use in the Merkle agent
 	for i := 0; i < b.N; i++ {
-		_, sig, err := Sign(merkleAgent, msg)
+		sig, err := Sign(merkleAgent, msg)
 		if nil != err {
 			if ErrOutOfKeys == err {
 				b.Log("merkleAgent has been worn out, aborting...")
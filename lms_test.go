@@ -1,7 +1,12 @@
 package lms
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -44,7 +49,7 @@ func TestLMSApp(t *testing.T) {
 		rand.Reader.Read(message)
 		signStart := time.Now()
 
-		_, sigraw, err := Sign(merkleAgent, message)
+		sigraw, err := Sign(merkleAgent, message)
 
 		signTime := time.Since(signStart)
 		if err != nil {
@@ -114,7 +119,7 @@ func TestLMSStdOps(t *testing.T) {
 	msg := make([]byte, lmots.N)
 	rand.Reader.Read(msg)
 
-	_, sig, err := Sign(merkleAgent, msg)
+	sig, err := Sign(merkleAgent, msg)
 	if nil != err {
 		t.Fatalf("error in signing %x", msg)
 	}
@@ -123,3 +128,185 @@ func TestLMSStdOps(t *testing.T) {
 		t.Fatal("verification failed")
 	}
 }
+
+func TestSignConcurrently(t *testing.T) {
+	const H, workers = 6, 8
+	seed := make([]byte, lmots.N)
+	rand.Reader.Read(seed)
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal("unexpected error in setting up")
+	}
+	dir, err := ioutil.TempDir("", "lms")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := merkleAgent.SetStateStore(NewFileStateStore(filepath.Join(dir, "state"))); nil != err {
+		t.Fatal(err)
+	}
+	pk := merkleAgent.PublicKey()
+
+	msg := make([]byte, lmots.N)
+	rand.Reader.Read(msg)
+
+	sigChan := make(chan *MerkleSig, 1<<H)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				sig, err := Sign(merkleAgent, msg)
+				if ErrOutOfKeys == err {
+					return
+				} else if nil != err {
+					t.Error(err)
+					return
+				}
+				sigChan <- sig
+			}
+		}()
+	}
+	wg.Wait()
+	close(sigChan)
+
+	used := make(map[uint32]bool)
+	for sig := range sigChan {
+		if used[sig.Opts.KeyIdx] {
+			t.Fatalf("leaf %d is used twice", sig.Opts.KeyIdx)
+		}
+		used[sig.Opts.KeyIdx] = true
+
+		if !Verify(merkleAgent.Root, msg, sig) || !pk.Verify(msg, sig) {
+			t.Fatalf("verification failed for leaf %d", sig.Opts.KeyIdx)
+		}
+	}
+
+	if len(used) != 1<<H {
+		t.Fatalf("want %d signatures, got %d", 1<<H, len(used))
+	}
+}
+
+func TestDebugSignWithKey(t *testing.T) {
+	const H = 2
+	seed := make([]byte, lmots.N)
+	rand.Reader.Read(seed)
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal("unexpected error in setting up")
+	}
+
+	msg := make([]byte, lmots.N)
+	rand.Reader.Read(msg)
+
+	sk, sig, err := DebugSignWithKey(merkleAgent, msg)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if !Verify(merkleAgent.Root, msg, sig) {
+		t.Fatal("verification failed")
+	}
+	if K, err := otsRecoverK(sig.Opts, msg, sig.LMSig); (nil != err) || !bytes.Equal(sk.K, K) {
+		t.Fatal("exposed key mismatches the signature")
+	}
+
+	// the exposed key should be the one of the leaf
+	sk2, err := merkleAgent.keyItr.At(sig.Opts.KeyIdx)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sk.K, sk2.K) {
+		t.Fatal("exposed key isn't the key of the leaf")
+	}
+
+	// the key is of no use once wiped as Sign does
+	wipeKey(sk)
+	for i := range sk.X {
+		if !isZero(sk.X[i]) {
+			t.Fatalf("private element %d isn't wiped", i)
+		}
+	}
+	otsSig, err := otsSign(rand.Reader, sk, msg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if K, err := otsRecoverK(sk2.Opts, msg, otsSig); (nil != err) || bytes.Equal(sk2.K, K) {
+		t.Fatal("private elements of the key aren't wiped")
+	}
+}
+
+func TestSignDeterministic(t *testing.T) {
+	const H = 3
+	seed := make([]byte, lmots.N)
+	I := make([]byte, lenI)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	for i := range I {
+		I[i] = byte(0xa0 + i)
+	}
+	msg := []byte("deterministic")
+
+	// independent agents of the same seed and I give the same signatures
+	sigData := make([][]byte, 2)
+	for i := range sigData {
+		merkleAgent, err := NewMerkleAgentWithOptions(seed, &AgentOpts{Typecode: LMS_SHA256_M32_H5, I: I})
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		sig, err := SignWithOpts(merkleAgent, msg, &SignOpts{Deterministic: true})
+		if nil != err {
+			t.Fatal(err)
+		}
+		if !merkleAgent.PublicKey().Verify(msg, sig) {
+			t.Fatal("verification failed")
+		}
+
+		if sigData[i], err = sig.MarshalBinary(); nil != err {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(sigData[0], sigData[1]) {
+		t.Fatal("deterministic signatures differ")
+	}
+
+	// the randomizer is drawn from the injected source
+	merkleAgent, err := NewMerkleAgentWithOptions(seed, &AgentOpts{Typecode: LMS_SHA256_M32_H5, I: I})
+	if nil != err {
+		t.Fatal(err)
+	}
+	C := bytes.Repeat([]byte{0x5a}, lmots.N)
+	sig, err := SignWithOpts(merkleAgent, msg, &SignOpts{Rand: bytes.NewReader(C)})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sig.LMSig.C, C) {
+		t.Fatalf("invalid randomizer: want %x, got %x", C, sig.LMSig.C)
+	}
+	if !Verify(merkleAgent.Root, msg, sig) {
+		t.Fatal("verification failed")
+	}
+}
+
+func TestSignDeterministicNotPositional(t *testing.T) {
+	const H = 2
+	seed := make([]byte, lmots.N)
+	rand.Reader.Read(seed)
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// mock up the state restored from keys drawn sequentially
+	merkleAgent.keyItr.rngSeed, merkleAgent.keyItr.seed = seed, nil
+
+	if _, err := SignWithOpts(merkleAgent, nil, &SignOpts{Deterministic: true}); ErrNotPositional != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrNotPositional, err)
+	}
+	if 0 != merkleAgent.LeafIdx() {
+		t.Fatalf("no leaf should be used, got leaf index %d", merkleAgent.LeafIdx())
+	}
+}
@@ -3,66 +3,274 @@ package lms
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
 	"math"
+	"runtime"
+	"sync"
 )
 
 // MerkleAgent implements a agent working
-// according to the Merkle signature scheme
+// according to the Merkle signature scheme,
+// which is safe for concurrent use
 type MerkleAgent struct {
+	mu sync.Mutex // guards the signing state below
+
 	H              uint32
 	auth           [][]byte
 	Root           []byte
 	nodeHouse      [][]byte
 	treeHashStacks []*TreeHashStack
 	keyItr         *KeyIterator
+	params         *ParamSet
+	store          StateStore
+	reserveBlock   uint32 // number of leaves to reserve per update of store
+	reserved       uint32 // leaves below reserved have been reserved in store
 }
 
 // NewMerkleAgent makes a fresh Merkle signing routine
-// by running the generate key and setup procedure
+// by running the generate key and setup procedure.
+// The tree is built by SHA3-256 and labelled by a private-use
+// typecode, see NewMerkleAgentWithTypecode for standard ones
 func NewMerkleAgent(H uint32, seed []byte) (*MerkleAgent, error) {
 	if H < 2 {
 		return nil, ErrInvalidHeight
 	}
 
+	return NewMerkleAgentWithTypecode(privateTypecode(H), seed)
+}
+
+// AgentOpts specifies options for making a MerkleAgent
+type AgentOpts struct {
+	Typecode    uint32 // LMS typecode specifying the parameter set
+	OtsTypecode uint32 // LM-OTS typecode of the leaves, 0 for those of w=4 hashing as the tree
+	Bounded     bool   // derive leaves on demand as NewBoundedMerkleAgent
+	Workers     int    // number of goroutines building the tree, non-positive for runtime.NumCPU()
+	I           []byte // key pair identifier, which is drawn randomly if nil
+}
+
+// NewMerkleAgentWithTypecode makes a fresh Merkle signing routine
+// for the parameter set specified by the LMS typecode, whose leaves
+// are LM-OTS keys of w=4 hashing as the tree
+func NewMerkleAgentWithTypecode(typecode uint32, seed []byte) (*MerkleAgent, error) {
+	return NewMerkleAgentWithOptions(seed, &AgentOpts{Typecode: typecode, Workers: 1})
+}
+
+// NewBoundedMerkleAgent makes a fresh Merkle signing routine for the
+// parameter set specified by the LMS typecode, which derives leaves on
+// demand instead of keeping all of them, so that the retained state is
+// of O(H^2) hash values at the cost of deriving about H leaves per
+// signature
+func NewBoundedMerkleAgent(typecode uint32, seed []byte) (*MerkleAgent, error) {
+	return NewMerkleAgentWithOptions(seed, &AgentOpts{Typecode: typecode, Bounded: true, Workers: 1})
+}
+
+// NewMerkleAgentWithOptions makes a fresh Merkle signing routine as
+// specified by opts, where the tree is built by opts.Workers goroutines
+// giving the same root and auth path as the serial procedure.
+// ErrParamSetMismatch is returned if opts.OtsTypecode doesn't hash
+// as the tree
+func NewMerkleAgentWithOptions(seed []byte, opts *AgentOpts) (*MerkleAgent, error) {
+	ps, err := LookupParamSet(opts.Typecode)
+	if nil != err {
+		return nil, err
+	}
+
+	otsTypecode := opts.OtsTypecode
+	if 0 == otsTypecode {
+		otsTypecode = ps.otsTypecode()
+	} else if !ps.matchesOTS(otsTypecode) {
+		return nil, ErrParamSetMismatch
+	}
+	keyItr := NewKeyIterator(seed)
+	setOTSTypecode(keyItr.LMOpts, otsTypecode)
+	if nil != opts.I {
+		if len(opts.I) != lenI {
+			return nil, ErrInvalidLength
+		}
+		copy(keyItr.LMOpts.I[:], opts.I)
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	return newMerkleAgent(ps, keyItr, opts.Bounded, workers)
+}
+
+// newMerkleAgent sets up the agent over keys derived by the positional
+// keyItr, whose typecode shall match ps, where leaves are cached unless
+// bounded
+func newMerkleAgent(ps *ParamSet, keyItr *KeyIterator, bounded bool, workers int) (*MerkleAgent, error) {
+	H := ps.H
+
 	agent := new(MerkleAgent)
 	agent.H = H
+	agent.params = ps
 	agent.auth = make([][]byte, H)
-	agent.nodeHouse = make([][]byte, 1<<H)
 	agent.treeHashStacks = make([]*TreeHashStack, H)
-	agent.keyItr = NewKeyIterator(seed)
-	export, err := agent.keyItr.Serialize()
-	if nil != err {
+	agent.keyItr = keyItr
+
+	if !bounded {
+		agent.nodeHouse = make([][]byte, 1<<H)
+
+		// each worker estimates a consecutive chunk of leaves
+		chunk := ((1 << H) + workers - 1) / workers
+		err := fanOut(workers, workers, func(w int) error {
+			for i := w * chunk; (i < (w+1)*chunk) && (i < (1 << H)); i++ {
+				sk, err := agent.keyItr.At(uint32(i))
+				if err != nil {
+					return err
+				}
+				agent.nodeHouse[i] = hashOTSPk(ps, &sk.PublicKey)
+				agent.keyItr.release(sk)
+			}
+
+			return nil
+		})
+		if nil != err {
+			return nil, err
+		}
+	}
+
+	if err := agent.buildTree(workers); nil != err {
 		return nil, err
 	}
 
-	for i := 0; i < (1 << H); i++ {
-		sk, err := agent.keyItr.Next()
-		if err != nil {
-			return nil, err
+	return agent, nil
+}
+
+// buildTree estimates the root, initial auth path and tree hash stacks.
+// The tree is split into 2^k subtrees of height H-k hashed concurrently,
+// whose roots are then merged level by level. The leftmost subtree also
+// sets up the auth path and stacks for the lower levels
+func (agent *MerkleAgent) buildTree(workers int) error {
+	H, ps := agent.H, agent.params
+	I := agent.keyItr.LMOpts.I[:]
+	leaves := agent.leaves()
+
+	// a few more subtrees than workers to balance the load
+	var k uint32
+	for (workers > 1) && (k+1 < H) && ((1 << k) < 4*workers) {
+		k++
+	}
+	height := H - k
+
+	roots := make([]*Node, 1<<k)
+	err := fanOut(len(roots), workers, func(s int) error {
+		if 0 == s {
+			root, err := agent.setupLowerLevels(height, leaves)
+			roots[s] = root
+			return err
 		}
-		agent.nodeHouse[i] = hashOTSPk(&sk.PublicKey, agent.H)
+
+		ths := NewTreeHashStack(uint32(s)<<height, height)
+		if err := ths.Update(ps, I, (1<<(height+1))-1, leaves); nil != err {
+			return err
+		}
+		roots[s] = ths.Top()
+
+		return nil
+	})
+	if nil != err {
+		return err
 	}
-	globalStack := NewTreeHashStack(0, H)
-	for h := uint32(0); h < H; h++ {
-		globalStack.Update(agent.keyItr.LMOpts.I[:], 1, agent.nodeHouse)
+
+	// merge the roots of subtrees up to the root of the tree
+	nodes := roots
+	for h := height; h < H; h++ {
+		agent.treeHashStacks[h] = NewTreeHashStack(0, h)
+		agent.treeHashStacks[h].nodeStack.Push(nodes[0])
+		agent.treeHashStacks[h].SetLeaf(1 << h)
+
+		agent.auth[h] = make([]byte, len(nodes[1].Nu))
+		copy(agent.auth[h], nodes[1].Nu)
+
+		parents := make([]*Node, len(nodes)/2)
+		err := fanOut(len(parents), workers, func(j int) error {
+			r := nodes[2*j].Index / 2
+			parents[j] = &Node{
+				Height: h + 1,
+				Nu:     merge(ps, I, r, nodes[2*j].Nu, nodes[2*j+1].Nu),
+				Index:  r,
+			}
+
+			return nil
+		})
+		if nil != err {
+			return err
+		}
+		nodes = parents
+	}
+
+	agent.Root = make([]byte, len(nodes[0].Nu))
+	copy(agent.Root, nodes[0].Nu)
+
+	return nil
+}
+
+// setupLowerLevels sets up the auth path and tree hash stacks for
+// heights below height along the leftmost subtree of that height,
+// and returns the root of the subtree
+func (agent *MerkleAgent) setupLowerLevels(height uint32, leaves LeafSource) (*Node, error) {
+	ps := agent.params
+	I := agent.keyItr.LMOpts.I[:]
+
+	globalStack := NewTreeHashStack(0, height)
+	for h := uint32(0); h < height; h++ {
+		if err := globalStack.Update(ps, I, 1, leaves); nil != err {
+			return nil, err
+		}
 		agent.treeHashStacks[h] = NewTreeHashStack(0, h)
 
 		agent.treeHashStacks[h].nodeStack.Push(globalStack.Top())
 		agent.treeHashStacks[h].SetLeaf(1 << h)
 
-		globalStack.Update(agent.keyItr.LMOpts.I[:], (1<<(h+1))-1, agent.nodeHouse)
+		if err := globalStack.Update(ps, I, (1<<(h+1))-1, leaves); nil != err {
+			return nil, err
+		}
 		agent.auth[h] = make([]byte, len(globalStack.Top().Nu))
 		copy(agent.auth[h], globalStack.Top().Nu)
 	}
 
-	globalStack.Update(agent.keyItr.LMOpts.I[:], 1, agent.nodeHouse)
-	agent.Root = make([]byte, len(globalStack.Top().Nu))
-	copy(agent.Root, globalStack.Top().Nu)
+	if err := globalStack.Update(ps, I, 1, leaves); nil != err {
+		return nil, err
+	}
+
+	return globalStack.Top(), nil
+}
+
+// leaves returns the source of leaves for tree hash, which are
+// either cached or derived on demand by the key iterator
+func (agent *MerkleAgent) leaves() LeafSource {
+	if nil != agent.nodeHouse {
+		return NodeHouse(agent.nodeHouse)
+	}
+
+	return &keyLeaves{agent.params, agent.keyItr}
+}
 
-	if err := agent.keyItr.Deserialize(export); nil != err {
+// keyLeaves derives leaves on demand from a positional key iterator
+type keyLeaves struct {
+	params *ParamSet
+	keyItr *KeyIterator
+}
+
+// NumLeaf returns the number of leaves
+func (kl *keyLeaves) NumLeaf() uint32 {
+	return 1 << kl.params.H
+}
+
+// Leaf estimates the idx-th leaf from its OTS public key
+func (kl *keyLeaves) Leaf(idx uint32) ([]byte, error) {
+	sk, err := kl.keyItr.At(idx)
+	if nil != err {
 		return nil, err
 	}
-	return agent, nil
+
+	defer kl.keyItr.release(sk)
+
+	return hashOTSPk(kl.params, &sk.PublicKey), nil
 }
 
 // refreshAuth updates auth path for next use
@@ -80,7 +288,8 @@ func (agent *MerkleAgent) refreshAuth() {
 }
 
 // refreshTreeHashStacks updates stack for next use
-func (agent *MerkleAgent) refreshTreeHashStacks() {
+func (agent *MerkleAgent) refreshTreeHashStacks() error {
+	leaves := agent.leaves()
 	numOp := 2*agent.H - 1
 	for i := uint32(0); i < numOp; i++ {
 		globalLowest := uint32(math.MaxUint32)
@@ -92,24 +301,52 @@ func (agent *MerkleAgent) refreshTreeHashStacks() {
 				focus = h
 			}
 		}
-		agent.treeHashStacks[focus].Update(agent.keyItr.LMOpts.I[:], 1, agent.nodeHouse)
+		err := agent.treeHashStacks[focus].Update(agent.params, agent.keyItr.LMOpts.I[:], 1, leaves)
+		if nil != err {
+			return err
+		}
 	}
+
+	return nil
 }
 
 // Traverse updates both auth path and retained stack for next use
-func (agent *MerkleAgent) Traverse() {
+func (agent *MerkleAgent) Traverse() error {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	return agent.traverse()
+}
+
+// traverse is Traverse without locking
+func (agent *MerkleAgent) traverse() error {
 	agent.refreshAuth()
-	agent.refreshTreeHashStacks()
+	return agent.refreshTreeHashStacks()
 }
 
-// SerializeSecretKey encodes all the secret data which shall be encrypted
+// SerializeSecretKey encodes all the secret data which shall be encrypted,
+// e.g., by ExportEncryptedSecretKey
 func (agent *MerkleAgent) SerializeSecretKey() []byte {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
 	secretData, _ := agent.keyItr.Serialize()
 	return secretData
 }
 
-// LeafIdx returns the index of next leaf to use
+// LeafIdx returns the index of next leaf to use, which is moved past
+// leaves burnt on binding to a StateStore. Leaves reserved in the
+// StateStore count as used, since they are burnt on restart, even
+// though Sign still hands out the Reserved ones
 func (agent *MerkleAgent) LeafIdx() uint32 {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	return agent.watermark()
+}
+
+// leafIdx returns the index of the next leaf handed out by Sign
+func (agent *MerkleAgent) leafIdx() uint32 {
 	return agent.keyItr.Offset()
 }
 
@@ -119,9 +356,11 @@ type merkleAgentEx struct {
 	Root           []byte
 	NodeHouse      [][]byte
 	TreeHashStacks []*TreeHashStack
+	Typecode       uint32
 }
 
-// GobEncode customizes the Gob encoding for MerkleAgent
+// GobEncode customizes the Gob encoding for MerkleAgent,
+// which is left unguarded for usage by Serialize
 func (agent *MerkleAgent) GobEncode() ([]byte, error) {
 	agentGob := &merkleAgentEx{
 		H:              agent.H,
@@ -129,6 +368,7 @@ func (agent *MerkleAgent) GobEncode() ([]byte, error) {
 		Root:           agent.Root,
 		NodeHouse:      agent.nodeHouse,
 		TreeHashStacks: agent.treeHashStacks,
+		Typecode:       agent.params.Typecode,
 	}
 
 	buf := new(bytes.Buffer)
@@ -139,7 +379,8 @@ func (agent *MerkleAgent) GobEncode() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// GobDecode customizes the Gob decoding for MerkleAgent
+// GobDecode customizes the Gob decoding for MerkleAgent,
+// which is left unguarded for usage by Rebuild
 func (agent *MerkleAgent) GobDecode(data []byte) error {
 	agentGob := new(merkleAgentEx)
 
@@ -147,11 +388,55 @@ func (agent *MerkleAgent) GobDecode(data []byte) error {
 		return err
 	}
 
+	// agents predating parameter sets are built by SHA3-256
+	if 0 == agentGob.Typecode {
+		agentGob.Typecode = privateTypecode(agentGob.H)
+	}
+	ps, err := LookupParamSet(agentGob.Typecode)
+	if nil != err {
+		return err
+	}
+
+	if agentGob.H != ps.H {
+		return fmt.Errorf("%w: height %d mismatches %s", ErrInvalidState, agentGob.H, ps.Name)
+	}
+	if len(agentGob.Root) != ps.M {
+		return fmt.Errorf("%w: root of %d bytes", ErrInvalidState, len(agentGob.Root))
+	}
+	if (len(agentGob.Auth) != int(ps.H)) || (len(agentGob.TreeHashStacks) != int(ps.H)) {
+		return fmt.Errorf("%w: %d auth nodes and %d tree hash stacks for height %d",
+			ErrInvalidState, len(agentGob.Auth), len(agentGob.TreeHashStacks), ps.H)
+	}
+	if (nil != agentGob.NodeHouse) && (len(agentGob.NodeHouse) != 1<<ps.H) {
+		return fmt.Errorf("%w: %d leaves for height %d", ErrInvalidState,
+			len(agentGob.NodeHouse), ps.H)
+	}
+	for _, nodes := range [][][]byte{agentGob.Auth, agentGob.NodeHouse} {
+		for _, node := range nodes {
+			if len(node) != ps.M {
+				return fmt.Errorf("%w: node of %d bytes", ErrInvalidState, len(node))
+			}
+		}
+	}
+	for h, ths := range agentGob.TreeHashStacks {
+		if (nil == ths) || (ths.height != uint32(h)) {
+			return fmt.Errorf("%w: tree hash stack %d doesn't target height %d",
+				ErrInvalidState, h, h)
+		}
+		for _, v := range ths.nodeStack.ValueSlice() {
+			if len(v.(*Node).Nu) != ps.M {
+				return fmt.Errorf("%w: node of %d bytes in tree hash stack %d",
+					ErrInvalidState, len(v.(*Node).Nu), h)
+			}
+		}
+	}
+
 	agent.H = agentGob.H
 	agent.auth = agentGob.Auth
 	agent.Root = agentGob.Root
 	agent.nodeHouse = agentGob.NodeHouse
 	agent.treeHashStacks = agentGob.TreeHashStacks
+	agent.params = ps
 
 	return nil
 }
@@ -159,6 +444,14 @@ func (agent *MerkleAgent) GobDecode(data []byte) error {
 // Serialize encodes all the information about the merkle tree
 // that can be stored as plaintext
 func (agent *MerkleAgent) Serialize() ([]byte, error) {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	return agent.serialize()
+}
+
+// serialize is Serialize without locking
+func (agent *MerkleAgent) serialize() ([]byte, error) {
 	buf := new(bytes.Buffer)
 	if err := gob.NewEncoder(buf).Encode(agent); nil != err {
 		return nil, err
@@ -168,17 +461,114 @@ func (agent *MerkleAgent) Serialize() ([]byte, error) {
 }
 
 // Rebuild restores the merkle agent from serialized bytes
-// and secret bytes
+// and secret bytes, where the restored state is checked against
+// the root before use, and leaves reserved in the bound store are
+// skipped if any. The agent is left untouched on failure
 func (agent *MerkleAgent) Rebuild(data []byte, secret []byte) error {
-	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(agent); nil != err {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	restored := new(MerkleAgent)
+	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(restored); nil != err {
 		return err
 	}
 
-	agent.keyItr = new(KeyIterator)
-	return agent.keyItr.Deserialize(secret)
+	restored.keyItr = new(KeyIterator)
+	if err := restored.keyItr.Deserialize(secret); nil != err {
+		return err
+	}
+
+	if !restored.params.matchesOTS(otsTypecode(restored.keyItr.LMOpts)) {
+		return ErrParamSetMismatch
+	}
+
+	// leaves of bounded agents are derived by their indexes
+	if (nil == restored.nodeHouse) && !restored.keyItr.positional() {
+		return ErrNotPositional
+	}
+
+	if err := restored.validate(); nil != err {
+		return err
+	}
+
+	// the bytes may be older than leaves already reserved in the store
+	if nil != agent.store {
+		restored.reserveBlock = agent.reserveBlock
+		if err := restored.setStateStore(agent.store); nil != err {
+			return err
+		}
+	}
+
+	agent.H, agent.auth, agent.Root = restored.H, restored.auth, restored.Root
+	agent.nodeHouse, agent.treeHashStacks = restored.nodeHouse, restored.treeHashStacks
+	agent.keyItr, agent.params = restored.keyItr, restored.params
+	agent.reserved = restored.reserved
+
+	return nil
 }
 
-// Exhausted checks if the agent can give us more keys to use
+// validate checks the restored agent against its root, which is
+// estimated from all cached leaves, and from the auth path of the
+// next leaf to use unless the agent is exhausted
+func (agent *MerkleAgent) validate() error {
+	if nil == agent.keyItr.LMOpts {
+		return fmt.Errorf("%w: key iterator misses LM-OTS options", ErrInvalidState)
+	}
+	I := agent.keyItr.LMOpts.I[:]
+
+	if nil != agent.nodeHouse {
+		level := agent.nodeHouse
+		for r := uint32(1) << agent.H; r > 1; r >>= 1 {
+			parents := make([][]byte, len(level)/2)
+			for i := range parents {
+				parents[i] = merge(agent.params, I, (r+uint32(2*i))/2, level[2*i], level[2*i+1])
+			}
+			level = parents
+		}
+
+		if !bytes.Equal(level[0], agent.Root) {
+			return fmt.Errorf("%w: leaves mismatch the root", ErrInvalidState)
+		}
+	}
+
+	if agent.exhausted() {
+		return nil
+	}
+
+	q := agent.leafIdx()
+	leaf, err := agent.leaves().Leaf(q)
+	if nil != err {
+		return err
+	}
+	if !bytes.Equal(climb(agent.params, I, q, leaf, agent.auth), agent.Root) {
+		return fmt.Errorf("%w: auth path of leaf %d mismatches the root", ErrInvalidState, q)
+	}
+
+	return nil
+}
+
+// Close wipes the secret data kept by the agent, i.e., the seed and
+// one-time private keys not yet wiped, after which signing fails with
+// ErrDestroyed until the agent is rebuilt
+func (agent *MerkleAgent) Close() error {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	agent.keyItr.Destroy()
+
+	return nil
+}
+
+// Exhausted checks if the agent can give us more keys to use, where
+// leaves reserved in the StateStore count as used as by LeafIdx
 func (agent *MerkleAgent) Exhausted() bool {
-	return (agent.keyItr.Offset() >> agent.H) > 0
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	return (agent.watermark() >> agent.H) > 0
+}
+
+// exhausted checks if Sign has handed out all leaves
+func (agent *MerkleAgent) exhausted() bool {
+	return (agent.leafIdx() >> agent.H) > 0
 }
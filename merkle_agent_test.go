@@ -3,6 +3,7 @@ package lms
 import (
 	"bytes"
 	"crypto/rand"
+	"errors"
 	"testing"
 
 	"github.com/LoCCS/lmots"
@@ -60,3 +61,330 @@ func TestMerkleAgent(t *testing.T) {
 		t.Fatalf("invalid private components: want %x, got %x", prkgData, prkgData2)
 	}
 }
+
+func TestBoundedMerkleAgent(t *testing.T) {
+	const H = 6
+
+	ps, err := LookupParamSet(privateTypecode(H))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	// both agents run over the same keys
+	keyItr := NewKeyIterator(seed)
+	prkgData, err := keyItr.Serialize()
+	if nil != err {
+		t.Fatal(err)
+	}
+	keyItr2 := new(KeyIterator)
+	if err := keyItr2.Deserialize(prkgData); nil != err {
+		t.Fatal(err)
+	}
+
+	merkleAgent, err := newMerkleAgent(ps, keyItr, false, 1)
+	if nil != err {
+		t.Fatal(err)
+	}
+	boundedAgent, err := newMerkleAgent(ps, keyItr2, true, 1)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(merkleAgent.Root, boundedAgent.Root) {
+		t.Fatalf("invalid root: want %x, got %x", merkleAgent.Root, boundedAgent.Root)
+	}
+
+	maData, err := merkleAgent.Serialize()
+	if nil != err {
+		t.Fatal(err)
+	}
+	boundedData, err := boundedAgent.Serialize()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(boundedData) >= len(maData) {
+		t.Fatalf("bounded agent should be more compact: %v bytes vs %v bytes",
+			len(boundedData), len(maData))
+	}
+
+	msg := make([]byte, lmots.N)
+	if _, err := rand.Read(msg); nil != err {
+		t.Fatal(err)
+	}
+
+	pk := boundedAgent.PublicKey()
+	for i := 0; i < 1<<H; i++ {
+		// restore the bounded agent midway
+		if (1 << (H - 1)) == i {
+			data, err := boundedAgent.Serialize()
+			if nil != err {
+				t.Fatal(err)
+			}
+			secret := boundedAgent.SerializeSecretKey()
+
+			boundedAgent = new(MerkleAgent)
+			if err := boundedAgent.Rebuild(data, secret); nil != err {
+				t.Fatal(err)
+			}
+		}
+
+		sig, err := Sign(merkleAgent, msg)
+		if nil != err {
+			t.Fatal(err)
+		}
+		sig2, err := Sign(boundedAgent, msg)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		for h := range sig.Auth {
+			if !bytes.Equal(sig.Auth[h], sig2.Auth[h]) {
+				t.Fatalf("invalid Auth[%v] for leaf %v: want %x, got %x", h, i,
+					sig.Auth[h], sig2.Auth[h])
+			}
+		}
+
+		if !pk.Verify(msg, sig2) {
+			t.Fatalf("verification failed for leaf %v", i)
+		}
+	}
+
+	if !boundedAgent.Exhausted() {
+		t.Fatal("bounded agent should have been exhausted")
+	}
+}
+
+func TestMerkleAgentParallelBuild(t *testing.T) {
+	const H = 7
+
+	ps, err := LookupParamSet(privateTypecode(H))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	prkgData, err := NewKeyIterator(seed).Serialize()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	for _, bounded := range []bool{false, true} {
+		var want []byte
+		for _, workers := range []int{1, 2, 3, 8, 200} {
+			keyItr := new(KeyIterator)
+			if err := keyItr.Deserialize(prkgData); nil != err {
+				t.Fatal(err)
+			}
+
+			merkleAgent, err := newMerkleAgent(ps, keyItr, bounded, workers)
+			if nil != err {
+				t.Fatal(err)
+			}
+
+			got, err := merkleAgent.Serialize()
+			if nil != err {
+				t.Fatal(err)
+			}
+
+			if 1 == workers {
+				want = got
+			} else if !bytes.Equal(want, got) {
+				t.Fatalf("invalid agent built by %v workers (bounded=%v)", workers, bounded)
+			}
+		}
+	}
+}
+
+func TestMerkleAgentOtsTypecode(t *testing.T) {
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+	msg := []byte("Hello LMS")
+
+	for _, typecode := range []uint32{
+		LMOTS_SHA256_N32_W1, LMOTS_SHA256_N32_W2, LMOTS_SHA256_N32_W8,
+	} {
+		opts := &AgentOpts{Typecode: LMS_SHA256_M32_H5, OtsTypecode: typecode}
+		merkleAgent, err := NewMerkleAgentWithOptions(seed, opts)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		sig, err := Sign(merkleAgent, msg)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if got := otsTypecode(sig.Opts); got != typecode {
+			t.Fatalf("invalid OTS typecode: want %x, got %x", typecode, got)
+		}
+		if !merkleAgent.PublicKey().Verify(msg, sig) {
+			t.Fatalf("verification failed for OTS typecode %x", typecode)
+		}
+	}
+
+	for _, opts := range []*AgentOpts{
+		{Typecode: LMS_SHA256_M32_H5, OtsTypecode: LMOTS_SHAKE_N32_W4},
+		{Typecode: LMS_SHA256_M32_H5, OtsTypecode: LMOTS_SHA256_N24_W4},
+		{Typecode: privateTypecode(5), OtsTypecode: LMOTS_SHA256_N32_W4},
+		{Typecode: LMS_SHA256_M32_H5, OtsTypecode: 0xdead},
+	} {
+		if _, err := NewMerkleAgentWithOptions(seed, opts); ErrParamSetMismatch != err {
+			t.Fatalf("invalid error for %+v: want %v, got %v", opts, ErrParamSetMismatch, err)
+		}
+	}
+}
+
+func TestRebuildRejectsCorruptedState(t *testing.T) {
+	const H = 4
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	// agent having signed some messages
+	newAgent := func(bounded bool) *MerkleAgent {
+		merkleAgent, err := NewMerkleAgentWithOptions(seed,
+			&AgentOpts{Typecode: privateTypecode(H), Bounded: bounded, Workers: 1})
+		if nil != err {
+			t.Fatal(err)
+		}
+		for i := 0; i < 5; i++ {
+			if _, err := Sign(merkleAgent, seed); nil != err {
+				t.Fatal(err)
+			}
+		}
+		return merkleAgent
+	}
+
+	otherAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		bounded bool
+		corrupt func(agent *MerkleAgent) // applied before serialization
+		secret  []byte                   // secret of the agent if nil
+	}{
+		{"tampered leaf", false, func(agent *MerkleAgent) {
+			agent.nodeHouse[9][0] ^= 0x01
+		}, nil},
+		{"tampered auth path", false, func(agent *MerkleAgent) {
+			agent.auth[2][0] ^= 0x01
+		}, nil},
+		{"tampered auth path of bounded agent", true, func(agent *MerkleAgent) {
+			agent.auth[0][0] ^= 0x01
+		}, nil},
+		{"leaf index moved back", true, func(agent *MerkleAgent) {
+			agent.keyItr.offset--
+		}, nil},
+		{"node exceeding target height", false, func(agent *MerkleAgent) {
+			agent.treeHashStacks[1].nodeStack.Push(&Node{Height: 2, Nu: make([]byte, 32)})
+		}, nil},
+		{"stacks swapped", false, func(agent *MerkleAgent) {
+			agent.treeHashStacks[0], agent.treeHashStacks[1] =
+				agent.treeHashStacks[1], agent.treeHashStacks[0]
+		}, nil},
+		{"truncated node house", false, func(agent *MerkleAgent) {
+			agent.nodeHouse = agent.nodeHouse[:1<<(H-1)]
+		}, nil},
+		{"height mismatching typecode", false, func(agent *MerkleAgent) {
+			agent.H--
+		}, nil},
+		{"key iterator of another tree", false, func(agent *MerkleAgent) {}, otherAgent.SerializeSecretKey()},
+	}
+
+	for _, c := range testCases {
+		merkleAgent := newAgent(c.bounded)
+		c.corrupt(merkleAgent)
+
+		data, err := merkleAgent.Serialize()
+		if nil != err {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		secret := c.secret
+		if nil == secret {
+			secret = merkleAgent.SerializeSecretKey()
+		}
+
+		if err := new(MerkleAgent).Rebuild(data, secret); !errors.Is(err, ErrInvalidState) {
+			t.Fatalf("%s: want %v, got %v", c.name, ErrInvalidState, err)
+		}
+	}
+
+	// intact state is accepted
+	merkleAgent := newAgent(true)
+	data, err := merkleAgent.Serialize()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := new(MerkleAgent).Rebuild(data, merkleAgent.SerializeSecretKey()); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestMerkleAgentClose(t *testing.T) {
+	const H = 3
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	retainedSeed := merkleAgent.keyItr.seed
+
+	sk, sig, err := DebugSignWithKey(merkleAgent, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	data, err := merkleAgent.Serialize()
+	if nil != err {
+		t.Fatal(err)
+	}
+	secret := merkleAgent.SerializeSecretKey()
+
+	if err := merkleAgent.Close(); nil != err {
+		t.Fatal(err)
+	}
+
+	if !isZero(retainedSeed) {
+		t.Fatal("seed isn't wiped")
+	}
+	if !keyWiped(sk) {
+		t.Fatal("exposed key isn't wiped")
+	}
+	if _, err := Sign(merkleAgent, seed); ErrDestroyed != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrDestroyed, err)
+	}
+	if nil != merkleAgent.SerializeSecretKey() {
+		t.Fatal("secret data is exported after closing")
+	}
+
+	// the closed agent is usable once rebuilt
+	if err := merkleAgent.Rebuild(data, secret); nil != err {
+		t.Fatal(err)
+	}
+	sig2, err := Sign(merkleAgent, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if (sig2.Opts.KeyIdx != sig.Opts.KeyIdx+1) || !Verify(merkleAgent.Root, seed, sig2) {
+		t.Fatal("rebuilt agent fails to sign")
+	}
+}
@@ -0,0 +1,117 @@
+package lms
+
+import (
+	"io"
+
+	"github.com/LoCCS/lmots"
+	"github.com/LoCCS/lmots/rand"
+)
+
+// SignMessage signs a message of arbitrary length, which is hashed
+// together with the randomizer C by LM-OTS as RFC 8554 specifies,
+// so no digest has to be made by the caller
+func (agent *MerkleAgent) SignMessage(msg []byte) (*MerkleSig, error) {
+	return Sign(agent, msg)
+}
+
+// SignReader signs the stream read from r until EOF without loading
+// it into memory. The stream is fed into the randomized message hashing
+// `H(I|u32str(q)|u16str(D_MESG)|C|stream)` of LM-OTS as RFC 8554
+// specifies, so the signature is the one SignMessage would make over
+// the whole stream. The leaf is reserved and used up before reading,
+// so concurrent signing on the agent doesn't wait for the stream, and
+// the leaf is burnt if reading fails. The one-time private key of the
+// leaf is wiped once the signature is made
+func (agent *MerkleAgent) SignReader(r io.Reader) (*MerkleSig, error) {
+	agent.mu.Lock()
+	sk, merkleSig, err := agent.nextLeaf()
+	agent.mu.Unlock()
+	if nil != sk {
+		defer agent.releaseKey(sk)
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	params, err := lookupOTSParams(sk.Opts)
+	if nil != err {
+		return nil, err
+	}
+
+	C := make([]byte, params.n)
+	if _, err := io.ReadFull(rand.Reader, C); nil != err {
+		return nil, err
+	}
+	Q, err := hashMessage(params, sk.Opts, C, r)
+	if nil != err {
+		return nil, err
+	}
+	merkleSig.LMSig = otsSignDigest(params, sk, C, Q)
+
+	return merkleSig, nil
+}
+
+// VerifyMessage verifies a Merkle signature over a message
+// produced by SignMessage
+func VerifyMessage(root []byte, msg []byte, merkleSig *MerkleSig) bool {
+	return Verify(root, msg, merkleSig)
+}
+
+// VerifyReader verifies a Merkle signature over the stream read from
+// r until EOF, which is made by SignReader or SignMessage over the
+// same bytes. Error is returned only if reading fails
+func VerifyReader(root []byte, r io.Reader, merkleSig *MerkleSig) (bool, error) {
+	if nil == merkleSig {
+		return false, nil
+	}
+
+	var readErr error
+	err := verify(merkleSig.Opts, root, recoverKFromReader(r, &readErr), merkleSig)
+	if nil != readErr {
+		return false, readErr
+	}
+
+	return nil == err, nil
+}
+
+// VerifyMessage checks the Merkle signature over a message
+// produced by SignMessage against the public key
+func (pk *PublicKey) VerifyMessage(msg []byte, merkleSig *MerkleSig) bool {
+	return pk.Verify(msg, merkleSig)
+}
+
+// VerifyReader checks the Merkle signature over the stream read from
+// r until EOF against the public key, which is made by SignReader or
+// SignMessage over the same bytes. Error is returned only if reading
+// fails
+func (pk *PublicKey) VerifyReader(r io.Reader, merkleSig *MerkleSig) (bool, error) {
+	var readErr error
+	err := pk.verify(recoverKFromReader(r, &readErr), merkleSig)
+	if nil != readErr {
+		return false, readErr
+	}
+
+	return nil == err, nil
+}
+
+// recoverKFromReader returns the kRecoverer over the message read
+// from r, which keeps the error of reading in readErr
+func recoverKFromReader(r io.Reader, readErr *error) kRecoverer {
+	return func(opts *lmots.LMOpts, lmSig *lmots.Sig) ([]byte, error) {
+		params, err := lookupOTSParams(opts)
+		if nil != err {
+			return nil, err
+		}
+		if err := checkOTSSig(params, opts, lmSig); nil != err {
+			return nil, err
+		}
+
+		Q, err := hashMessage(params, opts, lmSig.C, r)
+		if nil != err {
+			*readErr = err
+			return nil, err
+		}
+
+		return otsRecoverKFromDigest(params, opts, Q, lmSig), nil
+	}
+}
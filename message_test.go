@@ -0,0 +1,125 @@
+package lms
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/LoCCS/lmots"
+	"github.com/LoCCS/lmots/rand"
+)
+
+func TestSignMessage(t *testing.T) {
+	seed := make([]byte, lmots.N)
+	rand.Reader.Read(seed)
+	merkleAgent, err := NewMerkleAgentWithTypecode(LMS_SHA256_M32_H5, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pk := merkleAgent.PublicKey()
+
+	for _, msg := range [][]byte{nil, []byte("hello world"), make([]byte, 4096)} {
+		sig, err := merkleAgent.SignMessage(msg)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		if !VerifyMessage(merkleAgent.Root, msg, sig) || !pk.VerifyMessage(msg, sig) {
+			t.Fatalf("verification failed for message of %d bytes", len(msg))
+		}
+
+		tampered := append([]byte{0xff}, msg...)
+		if VerifyMessage(merkleAgent.Root, tampered, sig) || pk.VerifyMessage(tampered, sig) {
+			t.Fatal("tampered message passes verification")
+		}
+	}
+}
+
+func TestSignReader(t *testing.T) {
+	const H = 3
+	seed := make([]byte, lmots.N)
+	rand.Reader.Read(seed)
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pk := merkleAgent.PublicKey()
+
+	msg := make([]byte, 1<<20)
+	rand.Reader.Read(msg)
+
+	sig, err := merkleAgent.SignReader(bytes.NewReader(msg))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	ok, err := VerifyReader(merkleAgent.Root, bytes.NewReader(msg), sig)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("stream signature fails verification")
+	}
+	ok, err = pk.VerifyReader(bytes.NewReader(msg), sig)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("stream signature fails verification against public key")
+	}
+
+	// the stream is hashed as a whole message, so both ways interoperate
+	if !VerifyMessage(merkleAgent.Root, msg, sig) {
+		t.Fatal("stream signature fails verification as message signature")
+	}
+	msgSig, err := merkleAgent.SignMessage(msg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ok, err = pk.VerifyReader(bytes.NewReader(msg), msgSig)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("message signature fails verification as stream signature")
+	}
+
+	msg[len(msg)-1] ^= 0x01
+	if ok, _ := pk.VerifyReader(bytes.NewReader(msg), sig); ok {
+		t.Fatal("tampered stream passes verification")
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("broken stream")
+}
+
+func TestSignReaderError(t *testing.T) {
+	const H = 2
+	seed := make([]byte, lmots.N)
+	rand.Reader.Read(seed)
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if _, err := merkleAgent.SignReader(io.MultiReader(bytes.NewReader(seed), failingReader{})); nil == err {
+		t.Fatal("reading error is swallowed")
+	}
+
+	// the leaf is used up before reading, so it's burnt by failed reading
+	if 1 != merkleAgent.LeafIdx() {
+		t.Fatalf("want leaf index 1, got %d", merkleAgent.LeafIdx())
+	}
+
+	sig, err := merkleAgent.SignMessage(seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !VerifyMessage(merkleAgent.Root, seed, sig) {
+		t.Fatal("signing after failed reading fails verification")
+	}
+}
@@ -0,0 +1,278 @@
+package lms
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"io"
+
+	"github.com/LoCCS/lmots"
+)
+
+// The LM-OTS computations below follow RFC 8554 Section 4 for every
+// parameter set registered by RFC 8554 and NIST SP 800-208, whereas
+// lmots makes only keys of LMOTS_SHAKE_N32_W4, which it labels as
+// typecode 1. lmots is still taken for its types of keys and signatures
+
+// LM-OTS typecodes registered by RFC 8554 and NIST SP 800-208
+const (
+	LMOTS_SHA256_N32_W1 uint32 = 0x00000001
+	LMOTS_SHA256_N32_W2 uint32 = 0x00000002
+	LMOTS_SHA256_N32_W4 uint32 = 0x00000003
+	LMOTS_SHA256_N32_W8 uint32 = 0x00000004
+
+	LMOTS_SHA256_N24_W1 uint32 = 0x00000005
+	LMOTS_SHA256_N24_W2 uint32 = 0x00000006
+	LMOTS_SHA256_N24_W4 uint32 = 0x00000007
+	LMOTS_SHA256_N24_W8 uint32 = 0x00000008
+
+	LMOTS_SHAKE_N32_W1 uint32 = 0x00000009
+	LMOTS_SHAKE_N32_W2 uint32 = 0x0000000a
+	LMOTS_SHAKE_N32_W4 uint32 = 0x0000000b
+	LMOTS_SHAKE_N32_W8 uint32 = 0x0000000c
+
+	LMOTS_SHAKE_N24_W1 uint32 = 0x0000000d
+	LMOTS_SHAKE_N24_W2 uint32 = 0x0000000e
+	LMOTS_SHAKE_N24_W4 uint32 = 0x0000000f
+	LMOTS_SHAKE_N24_W8 uint32 = 0x00000010
+)
+
+// otsParamSet specifies a LM-OTS parameter set, where n is the length
+// in bytes of hash values, w the width in bits of Winternitz digits,
+// p the number of n-byte elements in a signature, and ls the left
+// shift of checksum
+type otsParamSet struct {
+	n, w, p, ls int
+	hash        func() hash.Hash
+}
+
+// otsParams is the registry of LM-OTS parameter sets by typecode
+var otsParams = map[uint32]*otsParamSet{
+	LMOTS_SHA256_N32_W1: {32, 1, 265, 7, sha256.New},
+	LMOTS_SHA256_N32_W2: {32, 2, 133, 6, sha256.New},
+	LMOTS_SHA256_N32_W4: {32, 4, 67, 4, sha256.New},
+	LMOTS_SHA256_N32_W8: {32, 8, 34, 0, sha256.New},
+
+	LMOTS_SHA256_N24_W1: {24, 1, 200, 8, newSHA256M24},
+	LMOTS_SHA256_N24_W2: {24, 2, 101, 6, newSHA256M24},
+	LMOTS_SHA256_N24_W4: {24, 4, 51, 4, newSHA256M24},
+	LMOTS_SHA256_N24_W8: {24, 8, 26, 0, newSHA256M24},
+
+	LMOTS_SHAKE_N32_W1: {32, 1, 265, 7, newSHAKEM32},
+	LMOTS_SHAKE_N32_W2: {32, 2, 133, 6, newSHAKEM32},
+	LMOTS_SHAKE_N32_W4: {32, 4, 67, 4, newSHAKEM32},
+	LMOTS_SHAKE_N32_W8: {32, 8, 34, 0, newSHAKEM32},
+
+	LMOTS_SHAKE_N24_W1: {24, 1, 200, 8, newSHAKEM24},
+	LMOTS_SHAKE_N24_W2: {24, 2, 101, 6, newSHAKEM24},
+	LMOTS_SHAKE_N24_W4: {24, 4, 51, 4, newSHAKEM24},
+	LMOTS_SHAKE_N24_W8: {24, 8, 26, 0, newSHAKEM24},
+}
+
+// lookupOTSParams returns the LM-OTS parameter set of the options
+func lookupOTSParams(opts *lmots.LMOpts) (*otsParamSet, error) {
+	params, ok := otsParams[otsTypecode(opts)]
+	if !ok {
+		return nil, ErrUnknownTypecode
+	}
+
+	return params, nil
+}
+
+// otsGenerateKey derives the LM-OTS key pair w.r.t opts from the seed,
+// whose private elements are `x[i]=H(I|u32str(q)|u16str(i)|u8str(0xff)|seed)`
+// and public key is `K=H(I|u32str(q)|u16str(D_PBLC)|y[0]|...|y[p-1])`
+// with y[i] at the end of the i-th chain from x[i]. This is how lmots
+// derives keys of LMOTS_SHAKE_N32_W4 from the n bytes it draws as seed
+func otsGenerateKey(opts *lmots.LMOpts, seed []byte) (*lmots.PrivateKey, error) {
+	params, err := lookupOTSParams(opts)
+	if nil != err {
+		return nil, err
+	}
+	max := 1<<uint(params.w) - 1
+
+	sk := &lmots.PrivateKey{X: make([][]byte, params.p)}
+	sk.Opts = opts.Clone()
+
+	pk := newOTSHash(params, opts, lmots.D_PBLC)
+	for i := range sk.X {
+		sk.X[i] = otsElement(params, opts, uint16(i), seed)
+		pk.Write(otsChain(params, opts, i, sk.X[i], 0, max))
+	}
+	sk.K = pk.Sum(nil)
+
+	return sk, nil
+}
+
+// otsElement derives `H(I|u32str(q)|u16str(i)|u8str(0xff)|seed)`
+// w.r.t opts, which is the i-th private element of the key
+func otsElement(params *otsParamSet, opts *lmots.LMOpts, i uint16, seed []byte) []byte {
+	sh := newOTSHash(params, opts, i)
+	sh.Write([]byte{0xff})
+	sh.Write(seed)
+
+	return sh.Sum(nil)
+}
+
+// otsSign makes the LM-OTS signature over msg by sk, where the
+// randomizer C is read from rng
+func otsSign(rng io.Reader, sk *lmots.PrivateKey, msg []byte) (*lmots.Sig, error) {
+	params, err := lookupOTSParams(sk.Opts)
+	if nil != err {
+		return nil, err
+	}
+
+	C := make([]byte, params.n)
+	if _, err := io.ReadFull(rng, C); nil != err {
+		return nil, err
+	}
+
+	sh := newMessageHash(params, sk.Opts, C)
+	sh.Write(msg)
+
+	return otsSignDigest(params, sk, C, sh.Sum(nil)), nil
+}
+
+// otsSignDigest makes the LM-OTS signature by sk over the digest Q
+// made with the randomizer C
+func otsSignDigest(params *otsParamSet, sk *lmots.PrivateKey, C, Q []byte) *lmots.Sig {
+	sig := &lmots.Sig{
+		Typecode: sk.Opts.Typecode,
+		C:        append([]byte{}, C...),
+		Sigma:    make([][]byte, params.p),
+	}
+
+	for i, a := range otsDigits(params, Q) {
+		sig.Sigma[i] = otsChain(params, sk.Opts, i, sk.X[i], 0, a)
+	}
+
+	return sig
+}
+
+// otsRecoverK estimates the candidate public key `Kc` from the
+// signature over msg w.r.t opts, which shall be of the parameter
+// set of opts already
+func otsRecoverK(opts *lmots.LMOpts, msg []byte, sig *lmots.Sig) ([]byte, error) {
+	params, err := lookupOTSParams(opts)
+	if nil != err {
+		return nil, err
+	}
+	if err := checkOTSSig(params, opts, sig); nil != err {
+		return nil, err
+	}
+
+	sh := newMessageHash(params, opts, sig.C)
+	sh.Write(msg)
+
+	return otsRecoverKFromDigest(params, opts, sh.Sum(nil), sig), nil
+}
+
+// checkOTSSig checks the signature is of the typecode of opts and
+// made up of elements of the lengths specified by params
+func checkOTSSig(params *otsParamSet, opts *lmots.LMOpts, sig *lmots.Sig) error {
+	if (sig.Typecode != opts.Typecode) || (len(sig.C) != params.n) ||
+		(len(sig.Sigma) != params.p) {
+		return ErrMalformedSig
+	}
+	for _, y := range sig.Sigma {
+		if len(y) != params.n {
+			return ErrMalformedSig
+		}
+	}
+
+	return nil
+}
+
+// otsRecoverKFromDigest estimates `Kc=H(I|u32str(q)|u16str(D_PBLC)|z[0]|...|z[p-1])`
+// from the signature over the digest Q
+func otsRecoverKFromDigest(params *otsParamSet, opts *lmots.LMOpts, Q []byte, sig *lmots.Sig) []byte {
+	max := 1<<uint(params.w) - 1
+
+	sh := newOTSHash(params, opts, lmots.D_PBLC)
+	for i, a := range otsDigits(params, Q) {
+		sh.Write(otsChain(params, opts, i, sig.Sigma[i], a, max))
+	}
+
+	return sh.Sum(nil)
+}
+
+// newOTSHash starts hashing `I|u32str(q)|u16str(D)` w.r.t opts
+func newOTSHash(params *otsParamSet, opts *lmots.LMOpts, D uint16) hash.Hash {
+	sh := params.hash()
+
+	sh.Write(opts.I[:])
+	sh.Write(u32str(opts.KeyIdx))
+	var buf [2]byte
+	binary.BigEndian.PutUint16(buf[:], D)
+	sh.Write(buf[:])
+
+	return sh
+}
+
+// newMessageHash starts the randomized message hashing of LM-OTS as
+// `Q=H(I|u32str(q)|u16str(D_MESG)|C|message)`, where the message is
+// to be written by the caller
+func newMessageHash(params *otsParamSet, opts *lmots.LMOpts, C []byte) hash.Hash {
+	sh := newOTSHash(params, opts, lmots.D_MESG)
+	sh.Write(C)
+
+	return sh
+}
+
+// hashMessage estimates the digest Q of LM-OTS over the message read
+// from r until EOF, which equals the one over the message in memory
+func hashMessage(params *otsParamSet, opts *lmots.LMOpts, C []byte, r io.Reader) ([]byte, error) {
+	sh := newMessageHash(params, opts, C)
+	if _, err := io.Copy(sh, r); nil != err {
+		return nil, err
+	}
+
+	return sh.Sum(nil), nil
+}
+
+// otsDigits returns the p Winternitz digits of `Q|Cksm(Q)`, i.e.,
+// the number of times each private element is hashed in a signature
+func otsDigits(params *otsParamSet, Q []byte) []int {
+	max := 1<<uint(params.w) - 1
+
+	coef := func(S []byte, i int) int {
+		b := S[i*params.w/8]
+		shift := 8 - (params.w*(i%(8/params.w)) + params.w)
+		return int(b>>uint(shift)) & max
+	}
+
+	sum := 0
+	for i := 0; i < params.n*8/params.w; i++ {
+		sum += max - coef(Q, i)
+	}
+	var cksm [2]byte
+	binary.BigEndian.PutUint16(cksm[:], uint16(sum<<uint(params.ls)))
+
+	S := append(append([]byte{}, Q...), cksm[:]...)
+	digits := make([]int, params.p)
+	for i := range digits {
+		digits[i] = coef(S, i)
+	}
+
+	return digits
+}
+
+// otsChain hashes x for the i-th element from step `from` to `to` as
+// `tmp=H(I|u32str(q)|u16str(i)|u8str(j)|tmp)`
+func otsChain(params *otsParamSet, opts *lmots.LMOpts, i int, x []byte, from, to int) []byte {
+	tmp := append([]byte{}, x...)
+	var buf [3]byte
+	binary.BigEndian.PutUint16(buf[:2], uint16(i))
+	for j := from; j < to; j++ {
+		buf[2] = byte(j)
+
+		sh := params.hash()
+		sh.Write(opts.I[:])
+		sh.Write(u32str(opts.KeyIdx))
+		sh.Write(buf[:])
+		sh.Write(tmp)
+		tmp = sh.Sum(tmp[:0])
+	}
+
+	return tmp
+}
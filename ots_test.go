@@ -0,0 +1,104 @@
+package lms
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/LoCCS/lmots"
+)
+
+func TestOTSParamSets(t *testing.T) {
+	msg := []byte("Hello LM-OTS")
+
+	for typecode, params := range otsParams {
+		opts := lmots.NewLMOpts()
+		opts.KeyIdx = 7
+		setOTSTypecode(opts, typecode)
+
+		seed := make([]byte, params.n)
+		if _, err := rand.Read(seed); nil != err {
+			t.Fatal(err)
+		}
+
+		sk, err := otsGenerateKey(opts, seed)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if (len(sk.X) != params.p) || (len(sk.K) != params.n) {
+			t.Fatalf("invalid key of %x: %d elements and K of %d bytes", typecode, len(sk.X), len(sk.K))
+		}
+
+		sig, err := otsSign(rand.Reader, sk, msg)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if (len(sig.C) != params.n) || (len(sig.Sigma) != params.p) {
+			t.Fatalf("invalid signature of %x: C of %d bytes and %d elements", typecode, len(sig.C), len(sig.Sigma))
+		}
+
+		K, err := otsRecoverK(opts, msg, sig)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(K, sk.K) {
+			t.Fatalf("invalid K recovered for %x: want %x, got %x", typecode, sk.K, K)
+		}
+
+		if K, err := otsRecoverK(opts, []byte("Hello LMS"), sig); (nil == err) && bytes.Equal(K, sk.K) {
+			t.Fatalf("signature of %x verifies another message", typecode)
+		}
+	}
+}
+
+// TestOTSAgreesWithLMOTS checks keys and signatures of
+// LMOTS_SHAKE_N32_W4 against those made by lmots
+func TestOTSAgreesWithLMOTS(t *testing.T) {
+	opts := lmots.NewLMOpts()
+	opts.KeyIdx = 5
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+	C := make([]byte, lmots.N)
+	if _, err := rand.Read(C); nil != err {
+		t.Fatal(err)
+	}
+	msg := []byte("Hello LM-OTS")
+
+	want, err := lmots.GenerateKey(opts, bytes.NewReader(seed))
+	if nil != err {
+		t.Fatal(err)
+	}
+	wantSig, err := lmots.Sign(bytes.NewReader(C), want, msg)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if err := fromLMOTSLabel(opts); nil != err {
+		t.Fatal(err)
+	}
+	sk, err := otsGenerateKey(opts, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sk.K, want.K) {
+		t.Fatalf("invalid K: want %x, got %x", want.K, sk.K)
+	}
+	for i := range want.X {
+		if !bytes.Equal(sk.X[i], want.X[i]) {
+			t.Fatalf("invalid x[%d]: want %x, got %x", i, want.X[i], sk.X[i])
+		}
+	}
+
+	sig, err := otsSign(bytes.NewReader(C), sk, msg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	for i := range wantSig.Sigma {
+		if !bytes.Equal(sig.Sigma[i], wantSig.Sigma[i]) {
+			t.Fatalf("invalid y[%d]: want %x, got %x", i, wantSig.Sigma[i], sig.Sigma[i])
+		}
+	}
+}
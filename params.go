@@ -1,13 +1,250 @@
 package lms
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
 	"hash"
 
+	"github.com/LoCCS/lmots"
 	"golang.org/x/crypto/sha3"
 )
 
-// HashFunc returns a consistent hash function for usage
-// across the whole project
+// lenI is the length of the key pair identifier I
+const lenI = len(lmots.LMOpts{}.I)
+
+// LMS typecodes registered by RFC 8554 and NIST SP 800-208
+const (
+	LMS_SHA256_M32_H5  uint32 = 0x00000005
+	LMS_SHA256_M32_H10 uint32 = 0x00000006
+	LMS_SHA256_M32_H15 uint32 = 0x00000007
+	LMS_SHA256_M32_H20 uint32 = 0x00000008
+	LMS_SHA256_M32_H25 uint32 = 0x00000009
+
+	LMS_SHA256_M24_H5  uint32 = 0x0000000a
+	LMS_SHA256_M24_H10 uint32 = 0x0000000b
+	LMS_SHA256_M24_H15 uint32 = 0x0000000c
+	LMS_SHA256_M24_H20 uint32 = 0x0000000d
+	LMS_SHA256_M24_H25 uint32 = 0x0000000e
+
+	LMS_SHAKE_M32_H5  uint32 = 0x0000000f
+	LMS_SHAKE_M32_H10 uint32 = 0x00000010
+	LMS_SHAKE_M32_H15 uint32 = 0x00000011
+	LMS_SHAKE_M32_H20 uint32 = 0x00000012
+	LMS_SHAKE_M32_H25 uint32 = 0x00000013
+
+	LMS_SHAKE_M24_H5  uint32 = 0x00000014
+	LMS_SHAKE_M24_H10 uint32 = 0x00000015
+	LMS_SHAKE_M24_H15 uint32 = 0x00000016
+	LMS_SHAKE_M24_H20 uint32 = 0x00000017
+	LMS_SHAKE_M24_H25 uint32 = 0x00000018
+)
+
+// lmsTypecodePrivate is the base of typecodes labelling the SHA3-256
+// based trees this package used to build exclusively. They aren't
+// registered by RFC 8554, so a private-use range is taken, in which
+// the lowest byte carries the tree height up to maxPrivateHeight
+const lmsTypecodePrivate uint32 = 0xe0000000
+
+// maxPrivateHeight is the largest height of trees labelled by the
+// private-use typecodes, whose node numbers `2^H+q` fit in uint32
+const maxPrivateHeight = 31
+
+// ParamSet specifies the hash function and shape of a LMS tree.
+// The LM-OTS keys on leaves shall hash by the same function into
+// M bytes as NIST SP 800-208 requires, see otsParams
+type ParamSet struct {
+	Typecode uint32           // LMS typecode
+	Name     string           // name of the parameter set
+	M        int              // length in bytes of each node
+	H        uint32           // height of the tree
+	Hash     func() hash.Hash // hash function producing M-byte output
+}
+
+// paramSets is the registry of parameter sets by typecode
+var paramSets = map[uint32]*ParamSet{
+	LMS_SHA256_M32_H5:  {LMS_SHA256_M32_H5, "LMS_SHA256_M32_H5", 32, 5, sha256.New},
+	LMS_SHA256_M32_H10: {LMS_SHA256_M32_H10, "LMS_SHA256_M32_H10", 32, 10, sha256.New},
+	LMS_SHA256_M32_H15: {LMS_SHA256_M32_H15, "LMS_SHA256_M32_H15", 32, 15, sha256.New},
+	LMS_SHA256_M32_H20: {LMS_SHA256_M32_H20, "LMS_SHA256_M32_H20", 32, 20, sha256.New},
+	LMS_SHA256_M32_H25: {LMS_SHA256_M32_H25, "LMS_SHA256_M32_H25", 32, 25, sha256.New},
+
+	LMS_SHA256_M24_H5:  {LMS_SHA256_M24_H5, "LMS_SHA256_M24_H5", 24, 5, newSHA256M24},
+	LMS_SHA256_M24_H10: {LMS_SHA256_M24_H10, "LMS_SHA256_M24_H10", 24, 10, newSHA256M24},
+	LMS_SHA256_M24_H15: {LMS_SHA256_M24_H15, "LMS_SHA256_M24_H15", 24, 15, newSHA256M24},
+	LMS_SHA256_M24_H20: {LMS_SHA256_M24_H20, "LMS_SHA256_M24_H20", 24, 20, newSHA256M24},
+	LMS_SHA256_M24_H25: {LMS_SHA256_M24_H25, "LMS_SHA256_M24_H25", 24, 25, newSHA256M24},
+
+	LMS_SHAKE_M32_H5:  {LMS_SHAKE_M32_H5, "LMS_SHAKE_M32_H5", 32, 5, newSHAKEM32},
+	LMS_SHAKE_M32_H10: {LMS_SHAKE_M32_H10, "LMS_SHAKE_M32_H10", 32, 10, newSHAKEM32},
+	LMS_SHAKE_M32_H15: {LMS_SHAKE_M32_H15, "LMS_SHAKE_M32_H15", 32, 15, newSHAKEM32},
+	LMS_SHAKE_M32_H20: {LMS_SHAKE_M32_H20, "LMS_SHAKE_M32_H20", 32, 20, newSHAKEM32},
+	LMS_SHAKE_M32_H25: {LMS_SHAKE_M32_H25, "LMS_SHAKE_M32_H25", 32, 25, newSHAKEM32},
+
+	LMS_SHAKE_M24_H5:  {LMS_SHAKE_M24_H5, "LMS_SHAKE_M24_H5", 24, 5, newSHAKEM24},
+	LMS_SHAKE_M24_H10: {LMS_SHAKE_M24_H10, "LMS_SHAKE_M24_H10", 24, 10, newSHAKEM24},
+	LMS_SHAKE_M24_H15: {LMS_SHAKE_M24_H15, "LMS_SHAKE_M24_H15", 24, 15, newSHAKEM24},
+	LMS_SHAKE_M24_H20: {LMS_SHAKE_M24_H20, "LMS_SHAKE_M24_H20", 24, 20, newSHAKEM24},
+	LMS_SHAKE_M24_H25: {LMS_SHAKE_M24_H25, "LMS_SHAKE_M24_H25", 24, 25, newSHAKEM24},
+}
+
+// HashFunc returns the SHA3-256 hash function, which builds the trees
+// labelled by the private-use typecodes and derives seeds internally
 func HashFunc() hash.Hash {
 	return sha3.New256()
 }
+
+// LookupParamSet returns the parameter set specified by the typecode
+func LookupParamSet(typecode uint32) (*ParamSet, error) {
+	if ps, ok := paramSets[typecode]; ok {
+		return ps, nil
+	}
+
+	H := typecode &^ lmsTypecodePrivate
+	if (typecode&lmsTypecodePrivate != lmsTypecodePrivate) || (H < 2) || (H > maxPrivateHeight) {
+		return nil, ErrUnknownTypecode
+	}
+
+	return &ParamSet{
+		Typecode: typecode,
+		Name:     fmt.Sprintf("LMS_SHA3_256_M32_H%d (private use)", H),
+		M:        32,
+		H:        H,
+		Hash:     HashFunc,
+	}, nil
+}
+
+// LookupParamSetByName returns the parameter set registered under the
+// name, e.g., "LMS_SHA256_M32_H10"
+func LookupParamSetByName(name string) (*ParamSet, error) {
+	for _, ps := range paramSets {
+		if ps.Name == name {
+			return ps, nil
+		}
+	}
+
+	return nil, ErrUnknownTypecode
+}
+
+// privateTypecode returns the private-use typecode of the SHA3-256
+// based tree of height H
+func privateTypecode(H uint32) uint32 {
+	return lmsTypecodePrivate | H
+}
+
+// private checks if the parameter set is labelled by a private-use
+// typecode
+func (ps *ParamSet) private() bool {
+	return ps.Typecode&lmsTypecodePrivate == lmsTypecodePrivate
+}
+
+// matchesOTS checks if the tree pairs with LM-OTS keys of the typecode,
+// i.e., both layers hash by the same function into M bytes. The
+// private-use trees take the keys lmots used to make only
+func (ps *ParamSet) matchesOTS(otsTypecode uint32) bool {
+	if ps.private() {
+		return LMOTS_SHAKE_N32_W4 == otsTypecode
+	}
+
+	params, ok := otsParams[otsTypecode]
+	if !ok || (params.n != ps.M) {
+		return false
+	}
+
+	// typecodes of the SHA-256 family precede those of SHAKE on both layers
+	return (ps.Typecode < LMS_SHAKE_M32_H5) == (otsTypecode < LMOTS_SHAKE_N32_W1)
+}
+
+// otsTypecode returns the typecode of the LM-OTS keys made for the
+// tree by default, i.e., those of w=4 hashing as the tree
+func (ps *ParamSet) otsTypecode() uint32 {
+	switch {
+	case ps.private():
+		return LMOTS_SHAKE_N32_W4
+	case ps.Typecode < LMS_SHA256_M24_H5:
+		return LMOTS_SHA256_N32_W4
+	case ps.Typecode < LMS_SHAKE_M32_H5:
+		return LMOTS_SHA256_N24_W4
+	case ps.Typecode < LMS_SHAKE_M24_H5:
+		return LMOTS_SHAKE_N32_W4
+	default:
+		return LMOTS_SHAKE_N24_W4
+	}
+}
+
+// otsTypecode converts the typecode of LM-OTS options into uint32
+func otsTypecode(opts *lmots.LMOpts) uint32 {
+	return binary.BigEndian.Uint32(opts.Typecode[:])
+}
+
+// setOTSTypecode sets the typecode of LM-OTS options
+func setOTSTypecode(opts *lmots.LMOpts, typecode uint32) {
+	binary.BigEndian.PutUint32(opts.Typecode[:], typecode)
+}
+
+// fromLMOTSLabel converts the typecode lmots labels its keys and
+// signatures by into the registered one, where lmots makes only
+// keys of LMOTS_SHAKE_N32_W4
+func fromLMOTSLabel(opts *lmots.LMOpts) error {
+	if lmots.LMOTS_SHAKE256_N32_W4 != otsTypecode(opts) {
+		return ErrUnknownTypecode
+	}
+	setOTSTypecode(opts, LMOTS_SHAKE_N32_W4)
+
+	return nil
+}
+
+// truncatedHash truncates the output of the underlying hash function
+type truncatedHash struct {
+	hash.Hash
+	size int
+}
+
+// Sum appends the truncated digest to b
+func (th *truncatedHash) Sum(b []byte) []byte {
+	return append(b, th.Hash.Sum(nil)[:th.size]...)
+}
+
+// Size returns the length of the truncated digest
+func (th *truncatedHash) Size() int {
+	return th.size
+}
+
+// shakeHash adapts SHAKE256 to a hash function of fixed output size
+type shakeHash struct {
+	sha3.ShakeHash
+	size int
+}
+
+// Sum appends the first size bytes of the output stream to b
+func (sh *shakeHash) Sum(b []byte) []byte {
+	digest := make([]byte, sh.size)
+	sh.ShakeHash.Clone().Read(digest)
+
+	return append(b, digest...)
+}
+
+// Size returns the length of the digest
+func (sh *shakeHash) Size() int {
+	return sh.size
+}
+
+// BlockSize returns the rate of SHAKE256
+func (sh *shakeHash) BlockSize() int {
+	return 136
+}
+
+// newSHA256M24 returns SHA-256 truncated to 192 bits
+func newSHA256M24() hash.Hash {
+	return &truncatedHash{sha256.New(), 24}
+}
+
+// newSHAKEM32 returns SHAKE256 with 256-bit output
+func newSHAKEM32() hash.Hash {
+	return &shakeHash{sha3.NewShake256(), 32}
+}
+
+// newSHAKEM24 returns SHAKE256 with 192-bit output
+func newSHAKEM24() hash.Hash {
+	return &shakeHash{sha3.NewShake256(), 24}
+}
@@ -0,0 +1,198 @@
+package lms
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/LoCCS/lmots"
+)
+
+func TestParamSets(t *testing.T) {
+	typecodes := []uint32{
+		LMS_SHA256_M32_H5, LMS_SHA256_M24_H5,
+		LMS_SHAKE_M32_H5, LMS_SHAKE_M24_H5,
+		privateTypecode(5),
+	}
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	msg := make([]byte, lmots.N)
+	if _, err := rand.Read(msg); nil != err {
+		t.Fatal(err)
+	}
+
+	for _, typecode := range typecodes {
+		ps, err := LookupParamSet(typecode)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if sz := ps.Hash().Size(); sz != ps.M {
+			t.Fatalf("invalid hash size for %s: want %v, got %v", ps.Name, ps.M, sz)
+		}
+
+		merkleAgent, err := NewMerkleAgentWithTypecode(typecode, seed)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if len(merkleAgent.Root) != ps.M {
+			t.Fatalf("invalid root size for %s: want %v, got %v", ps.Name, ps.M, len(merkleAgent.Root))
+		}
+
+		sig, err := Sign(merkleAgent, msg)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		data, err := sig.MarshalBinary()
+		if nil != err {
+			t.Fatal(err)
+		}
+		sig2 := new(MerkleSig)
+		if err := sig2.UnmarshalBinary(data); nil != err {
+			t.Fatal(err)
+		}
+		if sig2.Typecode != typecode {
+			t.Fatalf("invalid typecode: want %x, got %x", typecode, sig2.Typecode)
+		}
+
+		if !merkleAgent.PublicKey().Verify(msg, sig2) {
+			t.Fatalf("verification failed for %s", ps.Name)
+		}
+	}
+}
+
+func TestParamSetsMatchOTS(t *testing.T) {
+	typecodes := []uint32{privateTypecode(5)}
+	for typecode := range paramSets {
+		typecodes = append(typecodes, typecode)
+	}
+
+	for _, typecode := range typecodes {
+		ps, err := LookupParamSet(typecode)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		// the default keys and those of other widths of the same hash
+		if !ps.matchesOTS(ps.otsTypecode()) {
+			t.Fatalf("%s mismatches its default LM-OTS keys %x", ps.Name, ps.otsTypecode())
+		}
+
+		matches := 0
+		for otsTypecode := range otsParams {
+			if ps.matchesOTS(otsTypecode) {
+				matches++
+			}
+		}
+		if want := 4; ps.private() {
+			want = 1
+		} else if matches != want {
+			t.Fatalf("%s pairs with %d LM-OTS parameter sets, want %d", ps.Name, matches, want)
+		}
+	}
+}
+
+func TestLeafHash(t *testing.T) {
+	opts := lmots.NewLMOpts()
+	opts.KeyIdx = 3
+	pk := &lmots.PublicKey{Opts: opts, K: bytes.Repeat([]byte{0x5a}, 32)}
+
+	// H(I|u32str(r)|u16str(D_LEAF)|K) for trees of registered typecodes
+	ps, _ := LookupParamSet(LMS_SHA256_M32_H5)
+	want := sha256.New()
+	want.Write(opts.I[:])
+	want.Write([]byte{0x00, 0x00, 0x00, 0x23, 0x82, 0x82})
+	want.Write(pk.K)
+	if leaf := hashOTSPk(ps, pk); !bytes.Equal(leaf, want.Sum(nil)) {
+		t.Fatalf("invalid leaf of %s: want %x, got %x", ps.Name, want.Sum(nil), leaf)
+	}
+
+	// H(I|u32str(r)|u16str(D_LEAF)|typecode|I|u32str(q)|K) for private-use
+	// trees, where typecode is labelled by lmots
+	ps, _ = LookupParamSet(privateTypecode(5))
+	want = HashFunc()
+	want.Write(opts.I[:])
+	want.Write([]byte{0x00, 0x00, 0x00, 0x23, 0x82, 0x82})
+	want.Write([]byte{0x00, 0x00, 0x00, 0x01})
+	want.Write(opts.I[:])
+	want.Write([]byte{0x00, 0x00, 0x00, 0x03})
+	want.Write(pk.K)
+	if leaf := hashOTSPk(ps, pk); !bytes.Equal(leaf, want.Sum(nil)) {
+		t.Fatalf("invalid leaf of %s: want %x, got %x", ps.Name, want.Sum(nil), leaf)
+	}
+}
+
+func TestParamSetHashes(t *testing.T) {
+	data := []byte("Hello LMS")
+
+	ps, err := LookupParamSet(LMS_SHA256_M24_H10)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	sh := ps.Hash()
+	sh.Write(data)
+	if want := sha256.Sum256(data); !bytes.Equal(want[:24], sh.Sum(nil)) {
+		t.Fatalf("invalid SHA256/192: want %x, got %x", want[:24], sh.Sum(nil))
+	}
+
+	// SHAKE256 of shorter output is the prefix of the longer one
+	ps32, _ := LookupParamSet(LMS_SHAKE_M32_H10)
+	ps24, _ := LookupParamSet(LMS_SHAKE_M24_H10)
+	sh32, sh24 := ps32.Hash(), ps24.Hash()
+	sh32.Write(data)
+	sh24.Write(data)
+
+	digest := sh32.Sum(nil)
+	if !bytes.Equal(digest, sh32.Sum(nil)) {
+		t.Fatal("Sum shouldn't change the state of SHAKE256")
+	}
+	if !bytes.Equal(digest[:24], sh24.Sum(nil)) {
+		t.Fatalf("invalid SHAKE256/192: want %x, got %x", digest[:24], sh24.Sum(nil))
+	}
+}
+
+func TestLookupParamSet(t *testing.T) {
+	for typecode, ps := range paramSets {
+		H := uint32(5 * ((typecode-LMS_SHA256_M32_H5)%5 + 1))
+		M := 32
+		if (LMS_SHA256_M24_H5 <= typecode) && (typecode < LMS_SHAKE_M32_H5) ||
+			(LMS_SHAKE_M24_H5 <= typecode) {
+			M = 24
+		}
+
+		if (ps.Typecode != typecode) || (ps.H != H) || (ps.M != M) {
+			t.Fatalf("invalid %s: typecode %x, M=%d, H=%d", ps.Name, ps.Typecode, ps.M, ps.H)
+		}
+		if sz := ps.Hash().Size(); sz != ps.M {
+			t.Fatalf("invalid hash size for %s: want %v, got %v", ps.Name, ps.M, sz)
+		}
+	}
+
+	for _, typecode := range []uint32{0, 0x04, 0x19, privateTypecode(1), privateTypecode(0x100)} {
+		if _, err := LookupParamSet(typecode); ErrUnknownTypecode != err {
+			t.Fatalf("invalid error for %x: want %v, got %v", typecode, ErrUnknownTypecode, err)
+		}
+	}
+}
+
+func TestLookupParamSetByName(t *testing.T) {
+	for typecode, ps := range paramSets {
+		found, err := LookupParamSetByName(ps.Name)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if found.Typecode != typecode {
+			t.Fatalf("invalid typecode for %s: want %x, got %x", ps.Name, typecode, found.Typecode)
+		}
+	}
+
+	if _, err := LookupParamSetByName("LMS_SHA256_M32_H30"); ErrUnknownTypecode != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrUnknownTypecode, err)
+	}
+}
@@ -0,0 +1,114 @@
+package lms
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+)
+
+// OIDHSSLMSHashSig is id-alg-hss-lms-hashsig identifying HSS/LMS public
+// keys and signatures according to RFC 8708
+var OIDHSSLMSHashSig = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 3, 17}
+
+// pemTypePublicKey is the type of PEM blocks of public keys
+const pemTypePublicKey = "PUBLIC KEY"
+
+// subjectPublicKeyInfo is the ASN.1 structure of SubjectPublicKeyInfo
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// MarshalPKIXPublicKey encodes the public key as a DER-encoded
+// SubjectPublicKeyInfo according to RFC 8708, where the key shall be
+// *PublicKey, e.g., given by MerkleAgent.PublicKey, or *HSSPublicKey.
+// LMS public keys are encoded as HSS ones of a single level, and the
+// algorithm parameters are absent
+func MarshalPKIXPublicKey(pub interface{}) ([]byte, error) {
+	var hssPk *HSSPublicKey
+	switch pk := pub.(type) {
+	case *PublicKey:
+		hssPk = &HSSPublicKey{Levels: 1, PublicKey: pk}
+	case *HSSPublicKey:
+		hssPk = pk
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	pkData, err := hssPk.MarshalBinary()
+	if nil != err {
+		return nil, err
+	}
+
+	return asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: OIDHSSLMSHashSig},
+		PublicKey: asn1.BitString{Bytes: pkData, BitLength: 8 * len(pkData)},
+	})
+}
+
+// ParsePKIXPublicKey decodes the DER-encoded SubjectPublicKeyInfo made
+// by MarshalPKIXPublicKey. Keys of a single level are returned as
+// *PublicKey, and the others as *HSSPublicKey. The subject public key
+// wrapped in an OCTET STRING as some implementations of RFC 8708 do
+// is accepted as well
+func ParsePKIXPublicKey(der []byte) (interface{}, error) {
+	spki := new(subjectPublicKeyInfo)
+	rest, err := asn1.Unmarshal(der, spki)
+	if nil != err {
+		return nil, err
+	}
+	if 0 != len(rest) {
+		return nil, ErrInvalidLength
+	}
+
+	if !spki.Algorithm.Algorithm.Equal(OIDHSSLMSHashSig) ||
+		(0 != len(spki.Algorithm.Parameters.FullBytes)) {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if 0 != spki.PublicKey.BitLength%8 {
+		return nil, ErrMalformedPubKey
+	}
+
+	pkData := spki.PublicKey.RightAlign()
+	var wrapped []byte
+	if rest, err := asn1.Unmarshal(pkData, &wrapped); (nil == err) && (0 == len(rest)) {
+		pkData = wrapped
+	}
+
+	hssPk := new(HSSPublicKey)
+	if err := hssPk.UnmarshalBinary(pkData); nil != err {
+		return nil, err
+	}
+
+	if 1 == hssPk.Levels {
+		return hssPk.PublicKey, nil
+	}
+
+	return hssPk, nil
+}
+
+// MarshalPublicKeyPEM encodes the public key as a PEM block of type
+// "PUBLIC KEY" holding the SubjectPublicKeyInfo
+func MarshalPublicKeyPEM(pub interface{}) ([]byte, error) {
+	der, err := MarshalPKIXPublicKey(pub)
+	if nil != err {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypePublicKey, Bytes: der}), nil
+}
+
+// ParsePublicKeyPEM decodes the public key from the first PEM block of
+// type "PUBLIC KEY" in data, and returns it as ParsePKIXPublicKey does
+func ParsePublicKeyPEM(data []byte) (interface{}, error) {
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); nil == block {
+			return nil, ErrNoPEMBlock
+		}
+
+		if pemTypePublicKey == block.Type {
+			return ParsePKIXPublicKey(block.Bytes)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package lms
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"testing"
+
+	"github.com/LoCCS/lmots"
+)
+
+func TestPKIXPublicKey(t *testing.T) {
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	merkleAgent, err := NewMerkleAgentWithTypecode(LMS_SHA256_M32_H5, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pk := merkleAgent.PublicKey()
+
+	der, err := MarshalPKIXPublicKey(pk)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// SEQUENCE { SEQUENCE { OID 1.2.840.113549.1.9.16.3.17 } BIT STRING { u32str(1)|pub } }
+	header, _ := hex.DecodeString("304e300d060b2a864886f70d0109100311033d0000000001")
+	if !bytes.HasPrefix(der, header) {
+		t.Fatalf("invalid DER header: want %x, got %x", header, der[:len(header)])
+	}
+
+	parsed, err := ParsePKIXPublicKey(der)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if pk2, ok := parsed.(*PublicKey); !ok || !pk.Equal(pk2) {
+		t.Fatalf("invalid public key: want %+v, got %+v", pk, parsed)
+	}
+
+	// the subject public key wrapped in an OCTET STRING
+	pkData, err := (&HSSPublicKey{1, pk}).MarshalBinary()
+	if nil != err {
+		t.Fatal(err)
+	}
+	wrapped, err := asn1.Marshal(pkData)
+	if nil != err {
+		t.Fatal(err)
+	}
+	der2, err := asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: OIDHSSLMSHashSig},
+		PublicKey: asn1.BitString{Bytes: wrapped, BitLength: 8 * len(wrapped)},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if parsed, err := ParsePKIXPublicKey(der2); nil != err {
+		t.Fatal(err)
+	} else if !pk.Equal(parsed) {
+		t.Fatal("invalid public key wrapped in an OCTET STRING")
+	}
+
+	// keys of other algorithms are rejected
+	der3, err := asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 101, 112}},
+		PublicKey: asn1.BitString{Bytes: pkData, BitLength: 8 * len(pkData)},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err := ParsePKIXPublicKey(der3); ErrUnsupportedAlgorithm != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrUnsupportedAlgorithm, err)
+	}
+}
+
+func TestPKIXHSSPublicKey(t *testing.T) {
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	hss, err := NewHSS([]uint32{2, 2}, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pk := hss.PublicKey()
+
+	data, err := MarshalPublicKeyPEM(pk)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("-----BEGIN PUBLIC KEY-----\n")) {
+		t.Fatalf("invalid PEM block: %s", data)
+	}
+
+	// blocks of other types are skipped
+	data = append([]byte("-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"), data...)
+	parsed, err := ParsePublicKeyPEM(data)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pk2, ok := parsed.(*HSSPublicKey)
+	if !ok {
+		t.Fatalf("invalid type of public key: %T", parsed)
+	}
+	if (pk.Levels != pk2.Levels) || !pk.PublicKey.Equal(pk2.PublicKey) {
+		t.Fatalf("invalid public key: want %+v, got %+v", pk, pk2)
+	}
+
+	if _, err := ParsePublicKeyPEM([]byte("no PEM here")); ErrNoPEMBlock != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrNoPEMBlock, err)
+	}
+}
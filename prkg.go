@@ -3,44 +3,178 @@ package lms
 import (
 	"bytes"
 	"encoding/gob"
+	"io"
 
 	"github.com/LoCCS/lmots"
-	"github.com/LoCCS/lmots/rand"
+	"golang.org/x/crypto/sha3"
 )
 
 // KeyIterator is a prkg to produce a key chain for
 // user based on a seed
 type KeyIterator struct {
-	rng *rand.Rand
+	// the state of the rng drawing keys sequentially as the rand
+	//	package of lmots, which is nil for positional prkgs
+	rngSeed []byte
+	// the genesis seed deriving each key by its index,
+	//	which is nil if keys are drawn sequentially from rng
+	seed []byte
 	// the 0-based index of next running prkgation
 	//	w.r.t the initial genesis seed
 	offset uint32
 	// options specifying stuff like nonce for
 	//	randomizing hash function
 	*lmots.LMOpts
+	// copies of secret data handed out, which are wiped on Destroy
+	secrets *secretTracker
+	// whether the secret data has been wiped by Destroy
+	destroyed bool
 }
 
-// NewKeyIterator makes a prkg
+// NewKeyIterator makes a prkg deriving each key from the seed
+// and its index as RFC 8554 Appendix A, so that keys can be
+// estimated in any order
 func NewKeyIterator(compactSeed []byte) *KeyIterator {
 	prkg := new(KeyIterator)
 
-	prkg.rng = rand.New(compactSeed)
+	prkg.seed = make([]byte, len(compactSeed))
+	copy(prkg.seed, compactSeed)
 	prkg.offset = 0
 	prkg.LMOpts = lmots.NewLMOpts()
+	setOTSTypecode(prkg.LMOpts, LMOTS_SHAKE_N32_W4)
+	prkg.secrets = newSecretTracker()
 
 	return prkg
 }
 
-// Next estimates and returns the next sk-pk pair
+// Next estimates and returns the next sk-pk pair, where prkgs drawing
+// keys sequentially derive it from the n bytes read from the rng as
+// seed. The key is kept track of until wiped by Destroy
 func (prkg *KeyIterator) Next() (*lmots.PrivateKey, error) {
+	if prkg.destroyed {
+		return nil, ErrDestroyed
+	}
+
+	params, err := lookupOTSParams(prkg.LMOpts)
+	if nil != err {
+		return nil, err
+	}
+
 	prkg.LMOpts.KeyIdx = prkg.offset
-	keyPair, err := lmots.GenerateKey(prkg.LMOpts, prkg.rng)
+
+	var keyPair *lmots.PrivateKey
+	if prkg.positional() {
+		keyPair, err = prkg.At(prkg.offset)
+	} else {
+		seed := prkg.draw(params.n)
+		keyPair, err = otsGenerateKey(prkg.LMOpts, seed)
+		wipe(seed)
+		prkg.secrets.trackKey(keyPair)
+	}
 
 	prkg.offset++
 
 	return keyPair, err
 }
 
+// draw reads n bytes from the rng of prkgs drawing keys sequentially,
+// which squeezes SHAKE256 over the state into the next state followed
+// by the n bytes as the rand package of lmots does
+func (prkg *KeyIterator) draw(n int) []byte {
+	sh := sha3.NewShake256()
+	sh.Write(prkg.rngSeed)
+	sh.Read(prkg.rngSeed)
+
+	out := make([]byte, n)
+	sh.Read(out)
+
+	return out
+}
+
+// skip moves on to the next key without estimating it
+// unless keys are drawn sequentially from rng
+func (prkg *KeyIterator) skip() error {
+	if prkg.positional() {
+		prkg.offset++
+		return nil
+	}
+
+	keyPair, err := prkg.Next()
+	if nil != err {
+		return err
+	}
+	prkg.release(keyPair)
+
+	return nil
+}
+
+// positional checks if keys are derived by their indexes, which
+// fails only for states restored from prkgs drawing keys sequentially
+// from a rng, as made by earlier versions
+func (prkg *KeyIterator) positional() bool {
+	return nil != prkg.seed
+}
+
+// At estimates the sk-pk pair for the q-th leaf without touching the
+// offset, whose private elements are derived as
+// `x_q[i]=H(I|u32str(q)|u16str(i)|u8str(0xff)|SEED)`
+// according to RFC 8554 Appendix A. The key is kept track of until
+// wiped by Destroy
+func (prkg *KeyIterator) At(q uint32) (*lmots.PrivateKey, error) {
+	if prkg.destroyed {
+		return nil, ErrDestroyed
+	}
+	if !prkg.positional() {
+		return nil, ErrNotPositional
+	}
+
+	opts := prkg.LMOpts.Clone()
+	opts.KeyIdx = q
+
+	keyPair, err := otsGenerateKey(opts, prkg.seed)
+	prkg.secrets.trackKey(keyPair)
+
+	return keyPair, err
+}
+
+// release wipes the key pair returned by Next or At once used up
+func (prkg *KeyIterator) release(keyPair *lmots.PrivateKey) {
+	prkg.secrets.releaseKey(keyPair)
+}
+
+// Destroy wipes the seed, the state of rng, the outstanding key pairs
+// returned by Next or At, and buffers of serialization, after which no
+// more keys can be estimated
+func (prkg *KeyIterator) Destroy() {
+	wipe(prkg.seed)
+	wipe(prkg.rngSeed)
+	prkg.secrets.wipeAll()
+
+	prkg.seed, prkg.rngSeed = nil, nil
+	prkg.destroyed = true
+}
+
+// randomizer returns the source of the randomizer C signing with the
+// q-th key, which is derived from the seed as the private elements
+// are with the index 0xfffd none of them takes, i.e.,
+// `C=H(I|u32str(q)|u16str(0xfffd)|u8str(0xff)|SEED)`
+func (prkg *KeyIterator) randomizer(q uint32) (io.Reader, error) {
+	if prkg.destroyed {
+		return nil, ErrDestroyed
+	}
+	if !prkg.positional() {
+		return nil, ErrNotPositional
+	}
+
+	opts := prkg.LMOpts.Clone()
+	opts.KeyIdx = q
+	params, err := lookupOTSParams(opts)
+	if nil != err {
+		return nil, err
+	}
+
+	return bytes.NewReader(otsElement(params, opts, 0xfffd, prkg.seed)), nil
+}
+
 // Offset returns 0-based index of the **next** key
 // returned by this prkg
 func (prkg *KeyIterator) Offset() uint32 {
@@ -48,23 +182,37 @@ func (prkg *KeyIterator) Offset() uint32 {
 }
 
 type keyItrEx struct {
-	Seed   []byte
-	Offset uint32
-	Opts   *lmots.LMOpts
+	Seed       []byte
+	Offset     uint32
+	Opts       *lmots.LMOpts
+	Registered bool // Opts.Typecode is registered rather than labelled by lmots
+	Positional bool // keys are derived by index from Seed
 }
 
-// GobEncode customizes the Gob encoding scheme for KeyIterator
+// GobEncode customizes the Gob encoding scheme for KeyIterator,
+// whose output is kept track of until wiped by Serialize or Destroy
 func (prkg KeyIterator) GobEncode() ([]byte, error) {
+	if prkg.destroyed {
+		return nil, ErrDestroyed
+	}
+
 	prkgEx := &keyItrEx{
-		Seed:   prkg.rng.Seed(),
-		Offset: prkg.offset,
-		Opts:   prkg.LMOpts,
+		Offset:     prkg.offset,
+		Opts:       prkg.LMOpts,
+		Registered: true,
+		Positional: prkg.positional(),
+	}
+	if prkg.positional() {
+		prkgEx.Seed = prkg.seed
+	} else {
+		prkgEx.Seed = prkg.rngSeed
 	}
 
 	buf := new(bytes.Buffer)
 	if err := gob.NewEncoder(buf).Encode(prkgEx); nil != err {
 		return nil, err
 	}
+	prkg.secrets.trackBuffer(buf.Bytes())
 
 	return buf.Bytes(), nil
 }
@@ -77,9 +225,25 @@ func (prkg *KeyIterator) GobDecode(data []byte) error {
 		return err
 	}
 
-	prkg.rng = rand.New(prkgEx.Seed)
+	// prkgs predating registered typecodes draw keys of lmots
+	if !prkgEx.Registered {
+		if nil == prkgEx.Opts {
+			return ErrUnknownTypecode
+		}
+		if err := fromLMOTSLabel(prkgEx.Opts); nil != err {
+			return err
+		}
+	}
+
+	if prkgEx.Positional {
+		prkg.rngSeed, prkg.seed = nil, prkgEx.Seed
+	} else {
+		prkg.rngSeed, prkg.seed = prkgEx.Seed, nil
+	}
 	prkg.offset = prkgEx.Offset
 	prkg.LMOpts = prkgEx.Opts
+	prkg.secrets = newSecretTracker()
+	prkg.destroyed = false
 
 	return nil
 }
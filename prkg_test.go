@@ -3,6 +3,7 @@ package lms
 import (
 	"bytes"
 	"encoding/gob"
+	"encoding/hex"
 	"testing"
 
 	"github.com/LoCCS/lmots"
@@ -66,3 +67,228 @@ func TestKeyIterator(t *testing.T) {
 		}
 	}
 }
+
+// legacyKeyItrEx is the gob template of KeyIterator made by
+// versions predating registered typecodes
+type legacyKeyItrEx struct {
+	Seed   []byte
+	Offset uint32
+	Opts   *lmots.LMOpts
+}
+
+func TestKeyIteratorLegacy(t *testing.T) {
+	seed := make([]byte, lmots.N)
+	rand.Reader.Read(seed)
+
+	opts := lmots.NewLMOpts()
+
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(&legacyKeyItrEx{seed, 0, opts.Clone()}); nil != err {
+		t.Fatal(err)
+	}
+
+	iter := new(KeyIterator)
+	if err := iter.GobDecode(buf.Bytes()); nil != err {
+		t.Fatal(err)
+	}
+	if LMOTS_SHAKE_N32_W4 != otsTypecode(iter.LMOpts) {
+		t.Fatalf("invalid typecode: want %x, got %x", LMOTS_SHAKE_N32_W4, otsTypecode(iter.LMOpts))
+	}
+
+	// keys are drawn as lmots did
+	rng := rand.New(seed)
+	for q := uint32(0); q < 2; q++ {
+		opts.KeyIdx = q
+		want, err := lmots.GenerateKey(opts, rng)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		sk, err := iter.Next()
+		if nil != err {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sk.K, want.K) {
+			t.Fatalf("invalid K of key %d: want %x, got %x", q, want.K, sk.K)
+		}
+	}
+}
+
+// TestPositionalKeyIterator checks keys derived by index agree with
+// those running sequentially, including after recovery
+func TestPositionalKeyIterator(t *testing.T) {
+	seed := make([]byte, lmots.N)
+	rand.Reader.Read(seed)
+
+	iter := NewKeyIterator(seed)
+	iter.Next()
+
+	iter2 := new(KeyIterator)
+	data, err := iter.Serialize()
+	if nil != err {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := iter2.Deserialize(data); nil != err {
+		t.Fatal("invalid integrated seed")
+	}
+
+	for i := uint32(1); i < 3; i++ {
+		sk1, _ := iter.Next()
+		sk2, _ := iter2.At(i)
+
+		if !sk1.Equal(sk2) {
+			t.Fatal("private keys should be equal")
+		}
+	}
+
+	// prkgs drawing keys sequentially can't seek
+	legacy, err := mockUpPRKG()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err := legacy.At(0); ErrNotPositional != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrNotPositional, err)
+	}
+}
+
+// TestKeyIteratorAt checks keys derived by index against known
+// answers of the construction of RFC 8554 Appendix A, computed
+// independently for I=00..0f, SEED=20..3f and q=0x12345
+func TestKeyIteratorAt(t *testing.T) {
+	seed := make([]byte, 32)
+	for i := range seed {
+		seed[i] = byte(0x20 + i)
+	}
+
+	testCases := []struct {
+		typecode     uint32
+		x0, xLast, K string
+	}{
+		{
+			LMOTS_SHA256_N32_W4,
+			"ceedbf467353474bf1e4ac77ac2368ca676d14694fa214e3aa30c3bcc908eb72",
+			"7fb924aec8efc1d2fb8b53f2c15bddb37d41efa473d864522ddb1492e198e909",
+			"dbe2dae5844492a926e6f1eededcd978d065abf4b1a9bbe1f93c2a6b5f0f45fb",
+		},
+		{
+			LMOTS_SHAKE_N32_W4,
+			"21d29300a9ba925b8ca7bb147ad83ffacb515567fba6a6ccb69e7936bf086e3b",
+			"1074ff5b0394fb73afaf0e8e183fcb33ea5bcfd13b6b9c9d71383978146e63af",
+			"8a0d4c171393f970941706492f308b8f3048dd3530f8fcafb3aa6b0e3fbacb5a",
+		},
+	}
+
+	for _, c := range testCases {
+		iter := NewKeyIterator(seed)
+		setOTSTypecode(iter.LMOpts, c.typecode)
+		for i := range iter.LMOpts.I {
+			iter.LMOpts.I[i] = byte(i)
+		}
+
+		const q = 0x12345
+		sk, err := iter.At(q)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if 0 != iter.Offset() {
+			t.Fatalf("At shouldn't move the offset: got %v", iter.Offset())
+		}
+
+		for _, v := range []struct {
+			name      string
+			want, got []byte
+		}{
+			{"x[0]", mustDecodeHex(c.x0), sk.X[0]},
+			{"x[p-1]", mustDecodeHex(c.xLast), sk.X[len(sk.X)-1]},
+			{"K", mustDecodeHex(c.K), sk.K},
+		} {
+			if !bytes.Equal(v.want, v.got) {
+				t.Fatalf("invalid %s for typecode %x: want %x, got %x",
+					v.name, c.typecode, v.want, v.got)
+			}
+		}
+	}
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if nil != err {
+		panic(err)
+	}
+
+	return b
+}
+
+func TestKeyIteratorDestroy(t *testing.T) {
+	seed := make([]byte, lmots.N)
+	rand.Reader.Read(seed)
+
+	iter := NewKeyIterator(seed)
+	retainedSeed := iter.seed
+
+	// a key left outstanding, and a buffer of serialization
+	sk, err := iter.Next()
+	if nil != err {
+		t.Fatal(err)
+	}
+	buf, err := iter.GobEncode()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// buffers are wiped once serialized
+	if _, err := iter.Serialize(); nil != err {
+		t.Fatal(err)
+	}
+	if !isZero(buf) {
+		t.Fatal("buffer of serialization isn't wiped")
+	}
+	buf, err = iter.GobEncode()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	iter.Destroy()
+
+	if !isZero(retainedSeed) {
+		t.Fatal("seed isn't wiped")
+	}
+	if !isZero(buf) {
+		t.Fatal("buffer of serialization isn't wiped")
+	}
+	if !keyWiped(sk) {
+		t.Fatal("outstanding key isn't wiped")
+	}
+
+	if _, err := iter.Next(); ErrDestroyed != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrDestroyed, err)
+	}
+	if _, err := iter.At(0); ErrDestroyed != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrDestroyed, err)
+	}
+	if _, err := iter.Serialize(); nil == err {
+		t.Fatal("destroyed iterator shouldn't be serialized")
+	}
+
+	// prkgs drawing keys sequentially wipe the state of rng
+	legacy, err := mockUpPRKG()
+	if nil != err {
+		t.Fatal(err)
+	}
+	state := legacy.rngSeed
+	legacy.Destroy()
+	if !isZero(state) {
+		t.Fatal("state of rng isn't wiped")
+	}
+}
+
+// keyWiped checks if the private elements of the key are all zeros
+func keyWiped(sk *lmots.PrivateKey) bool {
+	for _, x := range sk.X {
+		if !isZero(x) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,163 @@
+package lms
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+)
+
+// PublicKey is the LMS public key, which binds the root of
+// the Merkle tree to the key pair identifier I and tree height
+type PublicKey struct {
+	Typecode    uint32 // LMS typecode
+	OtsTypecode uint32 // typecode of the LM-OTS keys on leaves
+	I           []byte // key pair identifier
+	Root        []byte // root of the Merkle tree, i.e., T[1]
+	Height      uint32 // height of the Merkle tree
+}
+
+// PublicKey returns the LMS public key of the agent
+func (agent *MerkleAgent) PublicKey() *PublicKey {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	pk := &PublicKey{
+		Typecode:    agent.params.Typecode,
+		OtsTypecode: otsTypecode(agent.keyItr.LMOpts),
+		I:           make([]byte, lenI),
+		Root:        make([]byte, len(agent.Root)),
+		Height:      agent.H,
+	}
+	copy(pk.I, agent.keyItr.LMOpts.I[:])
+	copy(pk.Root, agent.Root)
+
+	return pk
+}
+
+// Verify checks the Merkle signature over hash against the public key.
+// Signatures whose typecode, key pair identifier I or length of auth
+// path disagree with the key are rejected. The RFC 8554 encoding
+// doesn't carry I, in which case I is taken from the key
+func (pk *PublicKey) Verify(hash []byte, merkleSig *MerkleSig) bool {
+	return nil == pk.VerifyWithError(hash, merkleSig)
+}
+
+// VerifyWithError works as Verify, and tells why the signature fails
+// by errors like ErrTypecodeMismatch, ErrKeyIDMismatch and those of
+// VerifyWithError
+func (pk *PublicKey) VerifyWithError(hash []byte, merkleSig *MerkleSig) error {
+	return pk.verify(recoverK(hash), merkleSig)
+}
+
+// verify is VerifyWithError with the LM-OTS public key of the leaf
+// estimated by recoverer
+func (pk *PublicKey) verify(recoverer kRecoverer, merkleSig *MerkleSig) error {
+	if (nil == merkleSig) || (nil == merkleSig.Opts) || (nil == merkleSig.LMSig) {
+		return ErrMalformedSig
+	}
+
+	if (otsTypecode(merkleSig.Opts) != pk.OtsTypecode) ||
+		(binary.BigEndian.Uint32(merkleSig.LMSig.Typecode[:]) != pk.OtsTypecode) {
+		return ErrTypecodeMismatch
+	}
+
+	ps, err := merkleSig.paramSet()
+	if nil != err {
+		return err
+	}
+	if ps.Typecode != pk.Typecode {
+		return ErrTypecodeMismatch
+	}
+	if ps.H != pk.Height {
+		return ErrAuthPathLength
+	}
+
+	if !isZero(merkleSig.Opts.I[:]) && !bytes.Equal(merkleSig.Opts.I[:], pk.I) {
+		return ErrKeyIDMismatch
+	}
+
+	opts := merkleSig.Opts.Clone()
+	copy(opts.I[:], pk.I)
+
+	return verify(opts, pk.Root, recoverer, merkleSig)
+}
+
+// Equal checks if the public key equals x, which makes it
+// usable as the crypto.PublicKey of a crypto.Signer
+func (pk *PublicKey) Equal(x crypto.PublicKey) bool {
+	other, ok := x.(*PublicKey)
+	if !ok {
+		return false
+	}
+
+	return (pk.Typecode == other.Typecode) && (pk.OtsTypecode == other.OtsTypecode) &&
+		bytes.Equal(pk.I, other.I) && bytes.Equal(pk.Root, other.Root) &&
+		(pk.Height == other.Height)
+}
+
+// MarshalBinary encodes the public key as `lms_type|otstype|I|T[1]`
+// according to RFC 8554
+func (pk *PublicKey) MarshalBinary() ([]byte, error) {
+	ps, err := LookupParamSet(pk.Typecode)
+	if nil != err {
+		return nil, err
+	}
+
+	m := ps.M
+	if (len(pk.I) != lenI) || (len(pk.Root) != m) || (ps.H != pk.Height) {
+		return nil, ErrMalformedPubKey
+	}
+
+	data := make([]byte, 0, 8+lenI+m)
+	data = append(data, u32str(pk.Typecode)...)
+	data = append(data, u32str(pk.OtsTypecode)...)
+	data = append(data, pk.I...)
+	data = append(data, pk.Root...)
+
+	return data, nil
+}
+
+// UnmarshalBinary decodes the public key from the RFC 8554 encoding
+func (pk *PublicKey) UnmarshalBinary(data []byte) error {
+	key, rest, err := parsePublicKey(data)
+	if nil != err {
+		return err
+	}
+	if 0 != len(rest) {
+		return ErrInvalidLength
+	}
+
+	*pk = *key
+
+	return nil
+}
+
+// parsePublicKey decodes the RFC 8554 encoded public key in the
+// front of data, and returns the remaining bytes
+func parsePublicKey(data []byte) (*PublicKey, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, ErrInvalidLength
+	}
+
+	ps, err := LookupParamSet(binary.BigEndian.Uint32(data))
+	if nil != err {
+		return nil, nil, err
+	}
+
+	m := ps.M
+	if len(data) < 8+lenI+m {
+		return nil, nil, ErrInvalidLength
+	}
+
+	pk := &PublicKey{
+		Typecode:    ps.Typecode,
+		OtsTypecode: binary.BigEndian.Uint32(data[4:]),
+		I:           make([]byte, lenI),
+		Root:        make([]byte, m),
+		Height:      ps.H,
+	}
+	copy(pk.I, data[8:])
+	copy(pk.Root, data[8+lenI:])
+
+	return pk, data[8+lenI+m:], nil
+}
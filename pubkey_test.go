@@ -0,0 +1,158 @@
+package lms
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/LoCCS/lmots"
+)
+
+func TestPublicKeyVerify(t *testing.T) {
+	const H = 4
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pk := merkleAgent.PublicKey()
+
+	if pk.Height != H {
+		t.Fatalf("invalid height: want %v, got %v", H, pk.Height)
+	}
+
+	msg := make([]byte, lmots.N)
+	if _, err := rand.Read(msg); nil != err {
+		t.Fatal(err)
+	}
+
+	sig, err := Sign(merkleAgent, msg)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if !pk.Verify(msg, sig) {
+		t.Fatal("verification failed")
+	}
+
+	// signature bound to another key pair identifier
+	badSig := *sig
+	badSig.Opts = sig.Opts.Clone()
+	badSig.Opts.I[0] ^= 0xff
+	if pk.Verify(msg, &badSig) {
+		t.Fatal("signature with mismatched I should be rejected")
+	}
+
+	// signature claiming another OTS typecode
+	badSig.Opts = sig.Opts.Clone()
+	badSig.Opts.Typecode[3] ^= 0xff
+	if pk.Verify(msg, &badSig) {
+		t.Fatal("signature with mismatched OTS typecode should be rejected")
+	}
+
+	// auth path of wrong length
+	badSig.Opts = sig.Opts
+	badSig.Auth = sig.Auth[:H-1]
+	if pk.Verify(msg, &badSig) {
+		t.Fatal("signature with truncated auth path should be rejected")
+	}
+
+	// key for a tree of another height
+	badPk := *pk
+	badPk.Height, badPk.Typecode = H+1, privateTypecode(H+1)
+	if badPk.Verify(msg, sig) {
+		t.Fatal("signature with mismatched height should be rejected")
+	}
+}
+
+func TestVerifyWithError(t *testing.T) {
+	const H = 3
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pk := merkleAgent.PublicKey()
+
+	msg := make([]byte, lmots.N)
+	if _, err := rand.Read(msg); nil != err {
+		t.Fatal(err)
+	}
+
+	sig, err := Sign(merkleAgent, msg)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if err := VerifyWithError(merkleAgent.Root, msg, sig); nil != err {
+		t.Fatal(err)
+	}
+	if err := pk.VerifyWithError(msg, sig); nil != err {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name   string
+		mutate func(sig *MerkleSig) []byte // returns the message to verify
+		want   error
+	}{
+		{"nil LM-OTS signature", func(sig *MerkleSig) []byte {
+			sig.LMSig = nil
+			return msg
+		}, ErrMalformedSig},
+		{"leaf index out of range", func(sig *MerkleSig) []byte {
+			sig.Opts.KeyIdx = 1 << H
+			return msg
+		}, ErrIndexOutOfRange},
+		{"truncated auth path", func(sig *MerkleSig) []byte {
+			sig.Auth = sig.Auth[:H-1]
+			return msg
+		}, ErrAuthPathLength},
+		{"mismatched OTS typecode", func(sig *MerkleSig) []byte {
+			sig.Opts.Typecode[3] ^= 0xff
+			return msg
+		}, ErrTypecodeMismatch},
+		{"unknown LMS typecode", func(sig *MerkleSig) []byte {
+			sig.Typecode = 0xffff
+			return msg
+		}, ErrUnknownTypecode},
+		{"another message", func(sig *MerkleSig) []byte {
+			return append([]byte{0x00}, msg...)
+		}, ErrRootMismatch},
+		{"another leaf", func(sig *MerkleSig) []byte {
+			sig.Opts.KeyIdx ^= 1
+			return msg
+		}, ErrRootMismatch},
+	}
+
+	for _, c := range testCases {
+		badSig := *sig
+		badSig.Opts = sig.Opts.Clone()
+		badMsg := c.mutate(&badSig)
+
+		if err := VerifyWithError(merkleAgent.Root, badMsg, &badSig); c.want != err {
+			t.Fatalf("%s: want %v, got %v", c.name, c.want, err)
+		}
+		if err := pk.VerifyWithError(badMsg, &badSig); (nil == err) ||
+			((c.want != err) && (ErrTypecodeMismatch != err)) {
+			t.Fatalf("%s: want %v, got %v against public key", c.name, c.want, err)
+		}
+	}
+
+	// signature bound to another key pair identifier
+	badSig := *sig
+	badSig.Opts = sig.Opts.Clone()
+	badSig.Opts.I[0] ^= 0xff
+	if err := pk.VerifyWithError(msg, &badSig); ErrKeyIDMismatch != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrKeyIDMismatch, err)
+	}
+}
@@ -0,0 +1,100 @@
+package lms
+
+import (
+	"sync"
+
+	"github.com/LoCCS/lmots"
+)
+
+// secretTracker keeps track of the copies of secret data handed out
+// by a KeyIterator, i.e., one-time private keys and serialization
+// buffers, so that those not yet wiped can be cleared on Destroy
+type secretTracker struct {
+	mu   sync.Mutex
+	keys map[*lmots.PrivateKey]struct{}
+	bufs [][]byte
+}
+
+// newSecretTracker makes an empty tracker
+func newSecretTracker() *secretTracker {
+	return &secretTracker{keys: make(map[*lmots.PrivateKey]struct{})}
+}
+
+// trackKey registers the one-time private key
+func (st *secretTracker) trackKey(sk *lmots.PrivateKey) {
+	if (nil == st) || (nil == sk) {
+		return
+	}
+
+	st.mu.Lock()
+	st.keys[sk] = struct{}{}
+	st.mu.Unlock()
+}
+
+// releaseKey wipes the one-time private key and forgets it
+func (st *secretTracker) releaseKey(sk *lmots.PrivateKey) {
+	wipeKey(sk)
+	if nil == st {
+		return
+	}
+
+	st.mu.Lock()
+	delete(st.keys, sk)
+	st.mu.Unlock()
+}
+
+// trackBuffer registers the buffer holding secret data
+func (st *secretTracker) trackBuffer(b []byte) {
+	if nil == st {
+		return
+	}
+
+	st.mu.Lock()
+	st.bufs = append(st.bufs, b)
+	st.mu.Unlock()
+}
+
+// wipeBuffers wipes and forgets all buffers
+func (st *secretTracker) wipeBuffers() {
+	if nil == st {
+		return
+	}
+
+	st.mu.Lock()
+	for _, b := range st.bufs {
+		wipe(b)
+	}
+	st.bufs = nil
+	st.mu.Unlock()
+}
+
+// wipeAll wipes and forgets all keys and buffers
+func (st *secretTracker) wipeAll() {
+	if nil == st {
+		return
+	}
+
+	st.wipeBuffers()
+
+	st.mu.Lock()
+	for sk := range st.keys {
+		wipeKey(sk)
+	}
+	st.keys = make(map[*lmots.PrivateKey]struct{})
+	st.mu.Unlock()
+}
+
+// wipe overwrites b with zeros
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// wipeKey overwrites the private elements of the one-time
+// private key with zeros
+func wipeKey(sk *lmots.PrivateKey) {
+	for _, x := range sk.X {
+		wipe(x)
+	}
+}
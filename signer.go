@@ -0,0 +1,71 @@
+package lms
+
+import (
+	"crypto"
+	"io"
+)
+
+// Signer wraps a MerkleAgent as a crypto.Signer producing signatures
+// encoded according to RFC 8554.
+//
+// LMS is stateful: every signature burns a leaf of the tree, and Sign
+// fails with ErrOutOfKeys once all leaves are used. Bind a StateStore
+// by NewSigner (or SetStateStore of the agent) to persist the index of
+// the next leaf durably before each signature is released
+type Signer struct {
+	agent *MerkleAgent
+}
+
+// NewSigner makes a crypto.Signer out of the agent. If store isn't nil,
+// the agent is bound to it as SetStateStore does
+func NewSigner(agent *MerkleAgent, store StateStore) (*Signer, error) {
+	if nil != store {
+		if err := agent.SetStateStore(store); nil != err {
+			return nil, err
+		}
+	}
+
+	return &Signer{agent: agent}, nil
+}
+
+// Public returns the *PublicKey of the underlying agent
+func (signer *Signer) Public() crypto.PublicKey {
+	return signer.agent.PublicKey()
+}
+
+// Sign signs digest with the next unused leaf, and returns the
+// signature in the RFC 8554 encoding. LMS hashes the message itself
+// with a randomizer, so digest is signed as it is whatever hash
+// function opts names, and may well be the whole message when opts
+// is crypto.Hash(0). The randomizer is drawn from rand, or from the
+// default source of the lmots package if rand is nil. ErrOutOfKeys is
+// returned if no leaf is left
+func (signer *Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	merkleSig, err := SignWithOpts(signer.agent, digest, &SignOpts{Rand: rand})
+	if nil != err {
+		return nil, err
+	}
+
+	return merkleSig.MarshalBinary()
+}
+
+// Agent returns the underlying agent
+func (signer *Signer) Agent() *MerkleAgent {
+	return signer.agent
+}
+
+// Exhausted checks if no leaf is left for signing
+func (signer *Signer) Exhausted() bool {
+	return signer.agent.Exhausted()
+}
+
+// VerifySignature checks the RFC 8554 encoded signature produced by
+// Signer over digest against the public key
+func VerifySignature(pk *PublicKey, digest []byte, sig []byte) bool {
+	merkleSig := new(MerkleSig)
+	if err := merkleSig.UnmarshalBinary(sig); nil != err {
+		return false
+	}
+
+	return pk.Verify(digest, merkleSig)
+}
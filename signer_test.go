@@ -0,0 +1,60 @@
+package lms
+
+import (
+	"crypto"
+	"testing"
+
+	"github.com/LoCCS/lmots"
+	"github.com/LoCCS/lmots/rand"
+)
+
+// make sure Signer satisfies crypto.Signer
+var _ crypto.Signer = (*Signer)(nil)
+
+func TestSigner(t *testing.T) {
+	const H = 2
+	seed := make([]byte, lmots.N)
+	rand.Reader.Read(seed)
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	store := &countingStore{StateStore: new(memStateStore)}
+	signer, err := NewSigner(merkleAgent, store)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	pk, ok := signer.Public().(*PublicKey)
+	if !ok || !pk.Equal(merkleAgent.PublicKey()) {
+		t.Fatal("public key of signer mismatches the agent")
+	}
+
+	msg := []byte("hello world")
+	for i := 0; i < 1<<H; i++ {
+		sig, err := signer.Sign(nil, msg, crypto.Hash(0))
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		if !VerifySignature(pk, msg, sig) {
+			t.Fatalf("verification failed for signature %d", i)
+		}
+		if VerifySignature(pk, []byte("hello word"), sig) {
+			t.Fatal("signature passes verification over another message")
+		}
+	}
+
+	if _, err := signer.Sign(nil, msg, crypto.Hash(0)); ErrOutOfKeys != err {
+		t.Fatalf("want ErrOutOfKeys, got %v", err)
+	}
+	if !signer.Exhausted() {
+		t.Fatal("signer should be exhausted")
+	}
+
+	// each leaf is persisted before use, plus the binding
+	if store.numStore != 1+(1<<H) {
+		t.Fatalf("want %d state updates, got %d", 1+(1<<H), store.numStore)
+	}
+}
@@ -0,0 +1,332 @@
+package lms
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+
+	"github.com/LoCCS/lms/internal/atomicfile"
+)
+
+// SigningState is the durable part of the signing state of a MerkleAgent
+// or HSS, where the latter also records trees on every level
+type SigningState struct {
+	I    []byte // key pair identifier of the (top-level) tree
+	Next uint32 // index of the next leaf allowed for use on the (bottom-level) tree
+
+	Generations []uint32 // number of trees ever built on each level of HSS
+	Nexts       []uint32 // index of the next leaf allowed for use on each level of HSS
+}
+
+// StateStore persists the signing state of a MerkleAgent or HSS. Once
+// Store returns nil, the state must survive a crash of the process
+type StateStore interface {
+	// Store durably records the state
+	Store(state *SigningState) error
+	// Load returns the recorded state, or nil if nothing is recorded yet
+	Load() (*SigningState, error)
+}
+
+// SetStateStore binds the agent to store, so that Sign durably advances
+// the leaf index in store before releasing any OTS signature. If store
+// records a larger index than the agent, e.g., when the agent is
+// restored from stale bytes or leaves reserved by the previous run
+// are left unused, leaves in between are skipped for good. So does
+// Rebuild of an agent bound to a store
+func (agent *MerkleAgent) SetStateStore(store StateStore) error {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	return agent.setStateStore(store)
+}
+
+// setStateStore is SetStateStore without locking
+func (agent *MerkleAgent) setStateStore(store StateStore) error {
+	state, err := store.Load()
+	if nil != err {
+		return err
+	}
+
+	I := agent.keyItr.LMOpts.I[:]
+	if nil == state {
+		state = &SigningState{I: I, Next: agent.leafIdx()}
+		if err := store.Store(state); nil != err {
+			return err
+		}
+	} else if !bytes.Equal(state.I, I) {
+		return ErrStateMismatch
+	}
+
+	for (agent.leafIdx() < state.Next) && !agent.exhausted() {
+		if err := agent.skip(); nil != err {
+			return err
+		}
+	}
+
+	if state.Next < agent.leafIdx() {
+		if err := store.Store(&SigningState{I: I, Next: agent.leafIdx()}); nil != err {
+			return err
+		}
+	}
+	agent.store, agent.reserved = store, agent.leafIdx()
+
+	return nil
+}
+
+// SetReserveBlock sets the number of leaves reserved by each update
+// of the StateStore, which defaults to 1. Larger blocks save updates
+// at the cost of burning the unused leaves of the block on restart
+func (agent *MerkleAgent) SetReserveBlock(n uint32) {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	if 0 == n {
+		n = 1
+	}
+	agent.reserveBlock = n
+}
+
+// Reserved returns the number of leaves reserved in the StateStore
+// but not used yet, which would be burnt if the agent is restored
+func (agent *MerkleAgent) Reserved() uint32 {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	return agent.reservedLeft()
+}
+
+// reservedLeft is Reserved without locking
+func (agent *MerkleAgent) reservedLeft() uint32 {
+	if agent.reserved < agent.leafIdx() {
+		return 0
+	}
+
+	return agent.reserved - agent.leafIdx()
+}
+
+// watermark returns the index of the next leaf not reserved in the
+// StateStore, which is the next leaf to use if no store is bound
+func (agent *MerkleAgent) watermark() uint32 {
+	return agent.leafIdx() + agent.reservedLeft()
+}
+
+// reserve durably advances the leaf index past the next leaf
+// before it is used for signing, where a block of leaves is
+// reserved at once if no reserved leaf is left
+func (agent *MerkleAgent) reserve() error {
+	if (nil == agent.store) || (agent.reservedLeft() > 0) {
+		return nil
+	}
+
+	block := agent.reserveBlock
+	if 0 == block {
+		block = 1
+	}
+
+	next := uint64(agent.leafIdx()) + uint64(block)
+	if numLeaf := uint64(1) << agent.H; next > numLeaf {
+		next = numLeaf
+	}
+
+	err := agent.store.Store(&SigningState{
+		I:    agent.keyItr.LMOpts.I[:],
+		Next: uint32(next),
+	})
+	if nil != err {
+		return err
+	}
+	agent.reserved = uint32(next)
+
+	return nil
+}
+
+// skip burns the next leaf without signing
+func (agent *MerkleAgent) skip() error {
+	if agent.exhausted() {
+		return ErrOutOfKeys
+	}
+
+	if err := agent.keyItr.skip(); nil != err {
+		return err
+	}
+
+	return agent.traverse()
+}
+
+// SetStateStore binds the HSS to store as MerkleAgent.SetStateStore, so
+// that Sign durably reserves leaves on all levels before releasing any
+// OTS signature, including those over public keys of regenerated trees.
+// If store records more leaves used than the HSS, those leaves are
+// skipped for good and trees below them are rebuilt
+func (hss *HSS) SetStateStore(store StateStore) error {
+	hss.mu.Lock()
+	defer hss.mu.Unlock()
+
+	return hss.bindStateStore(store)
+}
+
+// bindStateStore binds the HSS to store with hss.mu held
+func (hss *HSS) bindStateStore(store StateStore) error {
+	state, err := store.Load()
+	if nil != err {
+		return err
+	}
+
+	current := hss.signingState()
+	if nil == state {
+		if err := store.Store(current); nil != err {
+			return err
+		}
+	} else {
+		L := len(hss.agents)
+		if !bytes.Equal(state.I, current.I) || (len(state.Generations) != L) ||
+			(len(state.Nexts) != L) {
+			return ErrStateMismatch
+		}
+
+		advanced, err := hss.advance(state)
+		if nil != err {
+			return err
+		}
+		if advanced {
+			if err := store.Store(hss.signingState()); nil != err {
+				return err
+			}
+		}
+	}
+	hss.store = store
+
+	return nil
+}
+
+// signingState returns the state of leaves used by the HSS
+func (hss *HSS) signingState() *SigningState {
+	L := len(hss.agents)
+
+	state := &SigningState{
+		I:           append([]byte{}, hss.agents[0].keyItr.LMOpts.I[:]...),
+		Generations: append([]uint32{}, hss.generations...),
+		Nexts:       make([]uint32, L),
+	}
+	for i, agent := range hss.agents {
+		state.Nexts[i] = agent.leafIdx()
+	}
+	state.Next = state.Nexts[L-1]
+
+	return state
+}
+
+// advance moves the HSS past the recorded state if it lags behind. On
+// the topmost level lagging behind, leaves are burnt up to the recorded
+// one, and trees below, which may have signed after the HSS was saved,
+// are regenerated as trees never built before
+func (hss *HSS) advance(state *SigningState) (bool, error) {
+	L := len(hss.agents)
+
+	for i, agent := range hss.agents {
+		gen, next := hss.generations[i], agent.leafIdx()
+		if (gen > state.Generations[i]) ||
+			((gen == state.Generations[i]) && (next > state.Nexts[i])) {
+			return false, nil
+		}
+		if (gen == state.Generations[i]) && (next == state.Nexts[i]) {
+			continue
+		}
+
+		// the tree on level i is stale as a whole unless generations agree
+		start := i
+		if gen == state.Generations[i] {
+			for (agent.leafIdx() < state.Nexts[i]) && !agent.exhausted() {
+				if err := agent.skip(); nil != err {
+					return false, err
+				}
+			}
+			start = i + 1
+		} else if 0 == i {
+			return false, ErrStateMismatch
+		}
+		if start == L {
+			return true, nil
+		}
+
+		// the lowest level above start which has keys left
+		d := start - 1
+		for (d >= 0) && hss.agents[d].exhausted() {
+			d--
+		}
+		if d < 0 {
+			return false, ErrOutOfKeys
+		}
+
+		for j := d + 1; j < L; j++ {
+			if hss.generations[j] < state.Generations[j] {
+				hss.generations[j] = state.Generations[j]
+			}
+			if err := hss.regenerate(j); nil != err {
+				return false, err
+			}
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// reserve durably records the leaves to be used by the signature, i.e.,
+// the next leaf on level d and the first leaf of regenerated trees below
+func (hss *HSS) reserve(d int) error {
+	if nil == hss.store {
+		return nil
+	}
+
+	state := hss.signingState()
+	state.Nexts[d]++
+	for i := d + 1; i < len(state.Nexts); i++ {
+		state.Generations[i]++
+		state.Nexts[i] = 1
+	}
+	state.Next = state.Nexts[len(state.Nexts)-1]
+
+	return hss.store.Store(state)
+}
+
+// FileStateStore is a StateStore backed by a file, which is
+// replaced atomically on each update
+type FileStateStore struct {
+	path string
+}
+
+// NewFileStateStore makes a StateStore backed by the file of path
+func NewFileStateStore(path string) *FileStateStore {
+	return &FileStateStore{path: path}
+}
+
+// Store writes the state into a temporary file in the same
+// directory, syncs it to disk and renames it as the store file
+func (fs *FileStateStore) Store(state *SigningState) error {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(state); nil != err {
+		return err
+	}
+
+	return atomicfile.WriteFile(fs.path, buf.Bytes())
+}
+
+// Load reads the state from the store file
+func (fs *FileStateStore) Load() (*SigningState, error) {
+	data, err := ioutil.ReadFile(fs.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if nil != err {
+		return nil, err
+	}
+
+	state := new(SigningState)
+	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(state); nil != err {
+		return nil, err
+	}
+
+	return state, nil
+}
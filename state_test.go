@@ -0,0 +1,389 @@
+package lms
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LoCCS/lmots"
+)
+
+var errCrash = errors.New("crashed")
+
+// crashingStore fails right after the state is durably stored,
+// which simulates a crash between reservation and signing
+type crashingStore struct {
+	StateStore
+}
+
+func (cs *crashingStore) Store(state *SigningState) error {
+	if err := cs.StateStore.Store(state); nil != err {
+		return err
+	}
+
+	return errCrash
+}
+
+func TestFileStateStore(t *testing.T) {
+	const H = 4
+
+	dir, err := ioutil.TempDir("", "lms")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	statePath := filepath.Join(dir, "state")
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pk := merkleAgent.PublicKey()
+
+	// the stale snapshot to restore from after crash
+	maData, err := merkleAgent.Serialize()
+	if nil != err {
+		t.Fatal(err)
+	}
+	prkgData := merkleAgent.SerializeSecretKey()
+
+	if err := merkleAgent.SetStateStore(NewFileStateStore(statePath)); nil != err {
+		t.Fatal(err)
+	}
+
+	msg := make([]byte, lmots.N)
+	if _, err := rand.Read(msg); nil != err {
+		t.Fatal(err)
+	}
+
+	used := make(map[uint32]bool)
+	for i := 0; i < 3; i++ {
+		sig, err := Sign(merkleAgent, msg)
+		if nil != err {
+			t.Fatal(err)
+		}
+		used[sig.Opts.KeyIdx] = true
+	}
+
+	// crash after reserving the 4th leaf
+	merkleAgent.store = &crashingStore{merkleAgent.store}
+	if _, err := Sign(merkleAgent, msg); errCrash != err {
+		t.Fatalf("invalid error: want %v, got %v", errCrash, err)
+	}
+
+	// restart from the stale snapshot
+	merkleAgent2 := new(MerkleAgent)
+	if err := merkleAgent2.Rebuild(maData, prkgData); nil != err {
+		t.Fatal(err)
+	}
+	if err := merkleAgent2.SetStateStore(NewFileStateStore(statePath)); nil != err {
+		t.Fatal(err)
+	}
+	if 4 != merkleAgent2.LeafIdx() {
+		t.Fatalf("invalid leaf index: want 4, got %v", merkleAgent2.LeafIdx())
+	}
+
+	for {
+		sig, err := Sign(merkleAgent2, msg)
+		if ErrOutOfKeys == err {
+			break
+		} else if nil != err {
+			t.Fatal(err)
+		}
+
+		if used[sig.Opts.KeyIdx] {
+			t.Fatalf("leaf %v is reused", sig.Opts.KeyIdx)
+		}
+		used[sig.Opts.KeyIdx] = true
+
+		if !pk.Verify(msg, sig) {
+			t.Fatalf("verification failed for leaf %v", sig.Opts.KeyIdx)
+		}
+	}
+
+	// the reserved leaf is burnt
+	if (1<<H)-1 != len(used) {
+		t.Fatalf("invalid number of used leaves: want %v, got %v", (1<<H)-1, len(used))
+	}
+
+	// the store can't be shared by another tree
+	merkleAgent3, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := merkleAgent3.SetStateStore(NewFileStateStore(statePath)); ErrStateMismatch != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrStateMismatch, err)
+	}
+}
+
+// countingStore counts the updates of the underlying store
+type countingStore struct {
+	StateStore
+	numStore int
+}
+
+func (cs *countingStore) Store(state *SigningState) error {
+	cs.numStore++
+	return cs.StateStore.Store(state)
+}
+
+func TestReserveBlock(t *testing.T) {
+	const H = 4
+	const block = 5
+
+	dir, err := ioutil.TempDir("", "lms")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	statePath := filepath.Join(dir, "state")
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	merkleAgent, err := NewMerkleAgent(H, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	maData, err := merkleAgent.Serialize()
+	if nil != err {
+		t.Fatal(err)
+	}
+	prkgData := merkleAgent.SerializeSecretKey()
+
+	store := &countingStore{StateStore: NewFileStateStore(statePath)}
+	if err := merkleAgent.SetStateStore(store); nil != err {
+		t.Fatal(err)
+	}
+	merkleAgent.SetReserveBlock(block)
+	store.numStore = 0
+
+	msg := make([]byte, lmots.N)
+	if _, err := rand.Read(msg); nil != err {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 7; i++ {
+		if _, err := Sign(merkleAgent, msg); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	if 2 != store.numStore {
+		t.Fatalf("invalid number of updates: want 2, got %v", store.numStore)
+	}
+	if 2*block-7 != merkleAgent.Reserved() {
+		t.Fatalf("invalid reserved leaves: want %v, got %v", 2*block-7, merkleAgent.Reserved())
+	}
+	if 2*block != merkleAgent.LeafIdx() {
+		t.Fatalf("reserved leaves should count as used: want %v, got %v", 2*block, merkleAgent.LeafIdx())
+	}
+
+	// leaves reserved but unused are burnt on restart
+	merkleAgent2 := new(MerkleAgent)
+	if err := merkleAgent2.Rebuild(maData, prkgData); nil != err {
+		t.Fatal(err)
+	}
+	if err := merkleAgent2.SetStateStore(NewFileStateStore(statePath)); nil != err {
+		t.Fatal(err)
+	}
+	if 2*block != merkleAgent2.LeafIdx() {
+		t.Fatalf("invalid leaf index: want %v, got %v", 2*block, merkleAgent2.LeafIdx())
+	}
+	merkleAgent2.SetReserveBlock(2 * block)
+
+	// the last block is cut off by the end of the tree
+	for i := 2 * block; i < 1<<H; i++ {
+		sig, err := Sign(merkleAgent2, msg)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if uint32(i) != sig.Opts.KeyIdx {
+			t.Fatalf("invalid leaf: want %v, got %v", i, sig.Opts.KeyIdx)
+		}
+
+		// the agent counts as exhausted once the end is reserved
+		if (1<<H != merkleAgent2.LeafIdx()) || !merkleAgent2.Exhausted() {
+			t.Fatalf("invalid leaf index %v after leaf %v", merkleAgent2.LeafIdx(), i)
+		}
+	}
+
+	if !merkleAgent2.Exhausted() || (0 != merkleAgent2.Reserved()) {
+		t.Fatal("agent should have been exhausted")
+	}
+	if state, err := NewFileStateStore(statePath).Load(); nil != err {
+		t.Fatal(err)
+	} else if 1<<H != state.Next {
+		t.Fatalf("invalid recorded index: want %v, got %v", 1<<H, state.Next)
+	}
+}
+
+// memStateStore keeps the state in memory
+type memStateStore struct {
+	state *SigningState
+}
+
+func (ms *memStateStore) Store(state *SigningState) error {
+	s := *state
+	ms.state = &s
+	return nil
+}
+
+func (ms *memStateStore) Load() (*SigningState, error) {
+	return ms.state, nil
+}
+
+// TestRebuildBoundStateStore checks an agent bound to a store never
+// reuses leaves after rebuilt from stale bytes
+func TestRebuildBoundStateStore(t *testing.T) {
+	const H = 4
+
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	msg := make([]byte, lmots.N)
+	if _, err := rand.Read(msg); nil != err {
+		t.Fatal(err)
+	}
+
+	for _, block := range []uint32{1, 5} {
+		merkleAgent, err := NewMerkleAgent(H, seed)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		maData, err := merkleAgent.Serialize()
+		if nil != err {
+			t.Fatal(err)
+		}
+		prkgData := merkleAgent.SerializeSecretKey()
+
+		if err := merkleAgent.SetStateStore(new(memStateStore)); nil != err {
+			t.Fatal(err)
+		}
+		merkleAgent.SetReserveBlock(block)
+
+		used := make(map[uint32]bool)
+		for i := 0; i < 3; i++ {
+			sig, err := Sign(merkleAgent, msg)
+			if nil != err {
+				t.Fatal(err)
+			}
+			used[sig.Opts.KeyIdx] = true
+		}
+
+		if err := merkleAgent.Rebuild(maData, prkgData); nil != err {
+			t.Fatal(err)
+		}
+
+		sig, err := Sign(merkleAgent, msg)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if used[sig.Opts.KeyIdx] {
+			t.Fatalf("leaf %v is reused with block %v", sig.Opts.KeyIdx, block)
+		}
+		if !merkleAgent.PublicKey().Verify(msg, sig) {
+			t.Fatal("verification failed")
+		}
+	}
+}
+
+// TestHSSStateStore checks no OTS key on any level of a HSS bound to a
+// store signs twice after the HSS is rebuilt from stale bytes
+func TestHSSStateStore(t *testing.T) {
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	hss, err := NewHSS([]uint32{2, 2}, seed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pk := hss.PublicKey()
+
+	if err := hss.SetStateStore(new(memStateStore)); nil != err {
+		t.Fatal(err)
+	}
+
+	// the message signed by each OTS key identified by I and q
+	signed := make(map[string][]byte)
+	sign := func(i int) error {
+		msg := []byte(fmt.Sprintf("message %d", i))
+
+		hssSig, err := hss.Sign(msg)
+		if nil != err {
+			return err
+		}
+		if !pk.Verify(msg, hssSig) {
+			t.Fatalf("verification failed for message %d", i)
+		}
+
+		sigs := []*MerkleSig{hssSig.Sig}
+		msgs := [][]byte{msg}
+		for _, signedPk := range hssSig.SignedPubKeys {
+			pkData, err := signedPk.PublicKey.MarshalBinary()
+			if nil != err {
+				t.Fatal(err)
+			}
+			sigs, msgs = append(sigs, signedPk.Sig), append(msgs, pkData)
+		}
+		for j, sig := range sigs {
+			key := fmt.Sprintf("%x|%d", sig.Opts.I, sig.Opts.KeyIdx)
+			if prev, ok := signed[key]; ok && !bytes.Equal(prev, msgs[j]) {
+				t.Fatalf("OTS key %s is reused", key)
+			}
+			signed[key] = msgs[j]
+		}
+
+		return nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := sign(i); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	// the stale snapshot to restore from
+	data, err := hss.Serialize()
+	if nil != err {
+		t.Fatal(err)
+	}
+	secret := hss.SerializeSecretKey()
+
+	// regenerate the bottom-level tree past the snapshot
+	for i := 3; i < 6; i++ {
+		if err := sign(i); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	if err := hss.Rebuild(data, secret); nil != err {
+		t.Fatal(err)
+	}
+
+	for i := 6; ; i++ {
+		if err := sign(i); ErrOutOfKeys == err {
+			break
+		} else if nil != err {
+			t.Fatal(err)
+		}
+	}
+}
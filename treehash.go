@@ -1,6 +1,7 @@
 package lms
 
 import (
+	"fmt"
 	"math"
 
 	"github.com/LoCCS/lms/container/stack"
@@ -13,6 +14,25 @@ type Node struct {
 	Index  uint32
 }
 
+// LeafSource provides the hash values of leaves of a Merkle tree
+type LeafSource interface {
+	NumLeaf() uint32                 // number of leaves on the tree
+	Leaf(idx uint32) ([]byte, error) // hash value of the idx-th leaf
+}
+
+// NodeHouse is a LeafSource keeping all leaves in memory
+type NodeHouse [][]byte
+
+// NumLeaf returns the number of leaves
+func (nh NodeHouse) NumLeaf() uint32 {
+	return uint32(len(nh))
+}
+
+// Leaf returns the idx-th leaf
+func (nh NodeHouse) Leaf(idx uint32) ([]byte, error) {
+	return nh[idx], nil
+}
+
 // TreeHashStack is a stack tracing the running state
 // of the tree hash algo
 type TreeHashStack struct {
@@ -45,6 +65,51 @@ func (th *TreeHashStack) Init(startingLeaf, h uint32) error {
 	return nil
 }
 
+// validate checks the invariants kept by Init and Update, i.e., the
+// leaves are within `[leafUpper-2^height, leafUpper]`, and nodes on
+// the stack are of heights no more than the target and decreasing
+// from the bottom, except for the top two awaiting merging
+func (th *TreeHashStack) validate() error {
+	if th.height >= 32 {
+		return fmt.Errorf("%w: target height %d is too large", ErrInvalidState, th.height)
+	}
+	if (th.leafUpper < (1 << th.height)) || (th.leaf > th.leafUpper) {
+		return fmt.Errorf("%w: leaf %d is out of range for upper bound %d of height %d",
+			ErrInvalidState, th.leaf, th.leafUpper, th.height)
+	}
+
+	nodes := th.nodeStack.ValueSlice()
+	if (th.leaf == th.leafUpper) && (0 == len(nodes)) {
+		return fmt.Errorf("%w: all leaves are consumed by an empty stack", ErrInvalidState)
+	}
+	if len(nodes) > int(th.height)+1 {
+		return fmt.Errorf("%w: %d nodes exceed a tree of height %d", ErrInvalidState,
+			len(nodes), th.height)
+	}
+
+	for i, v := range nodes {
+		node, ok := v.(*Node)
+		if !ok || (nil == node) {
+			return fmt.Errorf("%w: node %d is missing", ErrInvalidState, i)
+		}
+		if node.Height > th.height {
+			return fmt.Errorf("%w: node of height %d exceeds the target height %d",
+				ErrInvalidState, node.Height, th.height)
+		}
+
+		if 0 == i {
+			continue
+		}
+		below := nodes[i-1].(*Node).Height
+		if (node.Height > below) || ((node.Height == below) && (i != len(nodes)-1)) {
+			return fmt.Errorf("%w: node of height %d lies above the node of height %d",
+				ErrInvalidState, node.Height, below)
+		}
+	}
+
+	return nil
+}
+
 // IsCompleted checks if the tree hash instance has completed
 func (th *TreeHashStack) IsCompleted() bool {
 	return (th.leaf >= th.leafUpper) && (th.nodeStack.Peek().(*Node).Height == th.height)
@@ -72,11 +137,10 @@ func (th *TreeHashStack) Top() *Node {
 }
 
 // Update executes numOp updates on the instance, and
-// add on the new leaf derived by keyItr if necessary
-func (th *TreeHashStack) Update(I []byte, numOp uint32, nodeHouse [][]byte) {
-	//H := uint32(bits.Len32(uint32()) - 1)
-	numLeaf := uint32(len(nodeHouse))
-	//fmt.Println("H:", H)
+// add on the new leaf from leaves if necessary,
+// where nodes are merged by the hash function of ps
+func (th *TreeHashStack) Update(ps *ParamSet, I []byte, numOp uint32, leaves LeafSource) error {
+	numLeaf := leaves.NumLeaf()
 	for (numOp > 0) && !th.IsCompleted() {
 		// may have nodes at the same height to merge
 		if th.nodeStack.Len() >= 2 {
@@ -90,7 +154,7 @@ func (th *TreeHashStack) Update(I []byte, numOp uint32, nodeHouse [][]byte) {
 
 				th.nodeStack.Push(&Node{
 					Height: node1.Height + 1,
-					Nu:     merge(I, node2.Index/2, node2.Nu, node1.Nu),
+					Nu:     merge(ps, I, node2.Index/2, node2.Nu, node1.Nu),
 					Index:  node2.Index / 2,
 				})
 				numOp--
@@ -98,27 +162,29 @@ func (th *TreeHashStack) Update(I []byte, numOp uint32, nodeHouse [][]byte) {
 			}
 		}
 
-		// invoke key generator to make a new leaf and
-		//	add the new leaf to S
+		// fetch a new leaf and add the new leaf to S
 		if th.leaf >= numLeaf {
 			// dummy node
 			th.nodeStack.Push(&Node{
 				Height: 0,
-				Nu:     nodeHouse[0],
+				Nu:     make([]byte, ps.M),
 				Index:  numLeaf,
 			})
-			//fmt.Println("wooo")
 		} else {
-			//th.nodeStack.Push(&Node{0, nodeHouse[th.leaf]})
+			nu, err := leaves.Leaf(th.leaf)
+			if nil != err {
+				return err
+			}
+
 			th.nodeStack.Push(&Node{
 				Height: 0,
-				Nu:     nodeHouse[th.leaf],
+				Nu:     nu,
 				Index:  th.leaf + numLeaf,
 			})
-			//fmt.Printf("h: %v, index: %v, nu: %x, leaf: %v\n", 0,
-			//	th.leaf+(1<<H), nodeHouse[th.leaf], th.leaf)
 		}
 		th.leaf++
 		numOp--
 	}
+
+	return nil
 }
@@ -3,6 +3,7 @@ package lms
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
 
 	"github.com/LoCCS/lms/container/stack"
 )
@@ -37,7 +38,8 @@ func (ths TreeHashStack) GobEncode() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// GobDecode customizes the Gob decoding scheme for TreeHashStack
+// GobDecode customizes the Gob decoding scheme for TreeHashStack,
+// which rejects stacks breaking the invariants of tree hash
 func (ths *TreeHashStack) GobDecode(data []byte) error {
 	thsGob := new(thsEx)
 
@@ -45,14 +47,24 @@ func (ths *TreeHashStack) GobDecode(data []byte) error {
 		return err
 	}
 
-	ths.leaf = thsGob.Leaf
-	ths.leafUpper = thsGob.LeafUpper
-	ths.height = thsGob.H
-	ths.nodeStack = stack.New()
+	restored := &TreeHashStack{
+		leaf:      thsGob.Leaf,
+		leafUpper: thsGob.LeafUpper,
+		height:    thsGob.H,
+		nodeStack: stack.New(),
+	}
 
 	for _, n := range thsGob.NodeStack {
-		ths.nodeStack.Push(&Node{Height: n.Height, Nu: n.Nu, Index: n.Index})
+		if nil == n {
+			return fmt.Errorf("%w: node is missing", ErrInvalidState)
+		}
+		restored.nodeStack.Push(&Node{Height: n.Height, Nu: n.Nu, Index: n.Index})
+	}
+
+	if err := restored.validate(); nil != err {
+		return err
 	}
+	*ths = *restored
 
 	return nil
 }
@@ -21,13 +21,18 @@ func TestTreeHashIndexing(t *testing.T) {
 	}
 
 	const H = 3
+	ps, err := LookupParamSet(privateTypecode(H))
+	if nil != err {
+		t.Fatal(err)
+	}
+
 	ths := NewTreeHashStack(0, H)
-	nodeCache := make([][]byte, 1<<H)
+	nodeCache := make(NodeHouse, 1<<H)
 
 	i := 0
 	for !ths.IsCompleted() {
 		//ths.Update(1, nodeCache)
-		ths.Update(nil, 1, nodeCache)
+		ths.Update(ps, nil, 1, nodeCache)
 		node := ths.Top()
 
 		if hVec[i] != node.Height {
@@ -2,13 +2,15 @@ package lms
 
 import (
 	"encoding/binary"
+	"sync"
 
 	"github.com/LoCCS/lmots"
 )
 
 // merge estimates the hash for `I|r|D_INTR|left|right`
-func merge(I []byte, r uint32, left, right []byte) []byte {
-	sh := HashFunc()
+// by the hash function of the parameter set
+func merge(ps *ParamSet, I []byte, r uint32, left, right []byte) []byte {
+	sh := ps.Hash()
 
 	// key pair ID
 	sh.Write(I)
@@ -29,19 +31,20 @@ func merge(I []byte, r uint32, left, right []byte) []byte {
 	return sh.Sum(nil)
 }
 
-// hashOTSPk estimates the value for a leaf by its bounded
-// OTS public key, and it computes the hash value for a LM-OTS pk
-// by taking input as `I|r|D_LEAF|ots-pk`,
-// where `ots-pk=typecode|I|q|K`
-func hashOTSPk(pk *lmots.PublicKey, H uint32) []byte {
-	sh := HashFunc()
+// hashOTSPk estimates the value for a leaf by its bounded OTS public
+// key as `H(I|r|D_LEAF|K)` according to RFC 8554. Trees labelled by
+// the private-use typecodes take `ots-pk=typecode|I|q|K` in place of K
+// as this package used to, where typecode is the label lmots gives
+// LMOTS_SHAKE_N32_W4, so that their roots are kept
+func hashOTSPk(ps *ParamSet, pk *lmots.PublicKey) []byte {
+	sh := ps.Hash()
 
 	// key pair ID
 	sh.Write(pk.Opts.I[:])
 
 	var buf [4]byte
 	// node number
-	nodeIdx := pk.Opts.KeyIdx + (1 << H)
+	nodeIdx := pk.Opts.KeyIdx + (1 << ps.H)
 	binary.BigEndian.PutUint32(buf[:], nodeIdx)
 	sh.Write(buf[:])
 
@@ -49,12 +52,106 @@ func hashOTSPk(pk *lmots.PublicKey, H uint32) []byte {
 	binary.BigEndian.PutUint16(buf[:2], lmots.D_LEAF)
 	sh.Write(buf[:2])
 
-	// ots-pk
-	sh.Write(pk.Opts.Typecode[:])
-	sh.Write(pk.Opts.I[:])
-	binary.BigEndian.PutUint32(buf[:], pk.Opts.KeyIdx)
-	sh.Write(buf[:])
+	if ps.private() {
+		sh.Write(u32str(lmots.LMOTS_SHAKE256_N32_W4))
+		sh.Write(pk.Opts.I[:])
+		binary.BigEndian.PutUint32(buf[:], pk.Opts.KeyIdx)
+		sh.Write(buf[:])
+	}
 	sh.Write(pk.K)
 
 	return sh.Sum(nil)
 }
+
+// climb estimates the root from the leaf of index q and its auth path
+func climb(ps *ParamSet, I []byte, q uint32, leaf []byte, auth [][]byte) []byte {
+	// index of node in current height h
+	idx := q + (1 << ps.H)
+
+	parentHash := leaf
+	for h := uint32(0); h < ps.H; h++ {
+		// level up
+		if 1 == idx%2 {
+			parentHash = merge(ps, I, idx/2, auth[h], parentHash)
+		} else {
+			parentHash = merge(ps, I, idx/2, parentHash, auth[h])
+		}
+
+		idx = idx >> 1
+	}
+
+	return parentHash
+}
+
+// u32str encodes v as 4 bytes in big-endian order
+func u32str(v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+
+	return buf[:]
+}
+
+// isZero checks if all bytes of b are zero
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if 0 != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fanOut runs fn(0), ..., fn(n-1) over at most workers goroutines,
+// and returns the first error encountered
+func fanOut(n, workers int, fn func(i int) error) error {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			if err := fn(i); nil != err {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	jobs := make(chan int)
+	errs := make(chan error, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				if err := fn(i); nil != err {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case err := <-errs:
+			close(jobs)
+			wg.Wait()
+			return err
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,23 @@
+package x509
+
+import "errors"
+
+// Collections of errors while creating and parsing certificates
+var (
+	ErrUnsupportedSigner = errors.New("signer should be *lms.MerkleAgent or *lms.HSS")  // private key of unknown type
+	ErrUnsupportedKey    = errors.New("issuer key should be LMS or HSS")                // issuer key of other algorithms
+	ErrSignerMismatch    = errors.New("signer mismatches the public key of the parent") // signature fails under the parent key
+	ErrMalformedCert     = errors.New("malformed certificate")                          // certificate misses some components
+)
+
+// Collections of errors while verifying certificate chains
+var (
+	ErrNotCA              = errors.New("issuer isn't a CA")                            // basic constraints of the issuer don't allow issuance
+	ErrKeyUsage           = errors.New("issuer key isn't for signing certificates")    // key usage of the issuer lacks keyCertSign
+	ErrExpired            = errors.New("certificate is expired or not yet valid")      // current time is out of the validity period
+	ErrPathLength         = errors.New("path length constraint is violated")           // too many intermediates below a CA
+	ErrUnknownAuthority   = errors.New("certificate signed by unknown authority")      // no chain leads to a trusted root
+	ErrUnhandledCritical  = errors.New("unhandled critical extension")                 // certificate carries a critical extension unknown here
+	ErrSignatureAlgorithm = errors.New("signature algorithm isn't HSS/LMS")            // certificate isn't signed by HSS/LMS
+	ErrAlgorithmMismatch  = errors.New("signature algorithms of certificate mismatch") // outer and TBS algorithms disagree
+)
@@ -0,0 +1,142 @@
+package x509
+
+import (
+	"bytes"
+	"time"
+)
+
+// maxChainDepth bounds the number of certificates on a chain, which
+// stops the search looping over cross-signed intermediates
+const maxChainDepth = 16
+
+// VerifyOptions specifies the trusted roots and the intermediates
+// usable in building chains
+type VerifyOptions struct {
+	Roots         []*Certificate
+	Intermediates []*Certificate
+	CurrentTime   time.Time // the current time is used if zero
+}
+
+// Verify builds a chain from the certificate up to one of the roots
+// through the intermediates, and returns the chain starting with the
+// certificate and ending in the root. Every certificate on the chain
+// shall be valid at the current time, every issuer a CA whose path
+// length constraint holds, and every signature is checked by
+// HSSPublicKey.VerifyWithError. The first error met is returned if no
+// chain is found
+func (c *Certificate) Verify(opts VerifyOptions) ([]*Certificate, error) {
+	now := opts.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if err := c.isValid(now); nil != err {
+		return nil, err
+	}
+
+	// the trusted root itself
+	for _, root := range opts.Roots {
+		if c.Equal(root) {
+			return []*Certificate{c}, nil
+		}
+	}
+
+	chain, err := buildChain([]*Certificate{c}, &opts, now)
+	if nil != err {
+		return nil, err
+	}
+
+	return chain, nil
+}
+
+// isValid checks the validity period and critical extensions
+func (c *Certificate) isValid(now time.Time) error {
+	if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+		return ErrExpired
+	}
+	if 0 != len(c.UnhandledCriticalExtensions) {
+		return ErrUnhandledCritical
+	}
+
+	return nil
+}
+
+// buildChain extends the chain ending in a certificate not yet
+// trusted by issuers from the roots first and the intermediates next
+func buildChain(chain []*Certificate, opts *VerifyOptions, now time.Time) ([]*Certificate, error) {
+	child := chain[len(chain)-1]
+	err := ErrUnknownAuthority
+
+	for i, candidates := range [][]*Certificate{opts.Roots, opts.Intermediates} {
+		isRoot := 0 == i
+
+		for _, parent := range candidates {
+			if !mayIssue(parent, child) || inChain(chain, parent) {
+				continue
+			}
+
+			if e := checkIssuer(parent, chain, now); nil != e {
+				err = e
+				continue
+			}
+			if e := child.CheckSignatureFrom(parent); nil != e {
+				err = e
+				continue
+			}
+
+			next := append(append([]*Certificate{}, chain...), parent)
+			if isRoot {
+				return next, nil
+			}
+			if len(next) >= maxChainDepth {
+				continue
+			}
+
+			full, e := buildChain(next, opts, now)
+			if nil == e {
+				return full, nil
+			}
+			err = e
+		}
+	}
+
+	return nil, err
+}
+
+// mayIssue checks if the names and key identifiers of both certificates
+// allow the parent to be the issuer of the child
+func mayIssue(parent, child *Certificate) bool {
+	if !bytes.Equal(parent.RawSubject, child.RawIssuer) {
+		return false
+	}
+
+	return (0 == len(child.AuthorityKeyId)) || (0 == len(parent.SubjectKeyId)) ||
+		bytes.Equal(child.AuthorityKeyId, parent.SubjectKeyId)
+}
+
+// checkIssuer checks that the parent is valid at now, and its path
+// length constraint allows the intermediates on the chain below it
+func checkIssuer(parent *Certificate, chain []*Certificate, now time.Time) error {
+	if err := parent.isValid(now); nil != err {
+		return err
+	}
+
+	// the leaf isn't counted as an intermediate
+	if parent.BasicConstraintsValid && (parent.MaxPathLen >= 0) &&
+		(len(chain)-1 > parent.MaxPathLen) {
+		return ErrPathLength
+	}
+
+	return nil
+}
+
+// inChain checks if the certificate is already on the chain
+func inChain(chain []*Certificate, cert *Certificate) bool {
+	for _, c := range chain {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+
+	return false
+}
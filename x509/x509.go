@@ -0,0 +1,549 @@
+// Package x509 creates and verifies X.509 certificates issued by
+// HSS/LMS keys according to RFC 9802, which crypto/x509 cannot do.
+// Certificates are signed over the DER-encoded TBSCertificate by the
+// HSS/LMS signature of RFC 8554, whose algorithm identifier is
+// id-alg-hss-lms-hashsig without parameters. Subject keys may be of
+// other algorithms supported by crypto/x509
+package x509
+
+import (
+	"bytes"
+	"crypto/sha1"
+	stdx509 "crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/LoCCS/lms"
+)
+
+// pemTypeCertificate is the type of PEM blocks of certificates
+const pemTypeCertificate = "CERTIFICATE"
+
+// object identifiers of the extensions handled by the package
+var (
+	oidExtensionSubjectKeyID     = asn1.ObjectIdentifier{2, 5, 29, 14}
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionAuthorityKeyID   = asn1.ObjectIdentifier{2, 5, 29, 35}
+)
+
+// Certificate is an X.509 v3 certificate, which serves as the template
+// of CreateCertificate as well
+type Certificate struct {
+	Raw                     []byte // complete DER-encoded certificate
+	RawTBSCertificate       []byte // DER-encoded TBSCertificate, i.e., the signed message
+	RawSubjectPublicKeyInfo []byte
+	RawSubject              []byte
+	RawIssuer               []byte
+
+	Signature []byte // HSS signature encoded according to RFC 8554
+
+	SerialNumber *big.Int
+	Issuer       pkix.Name
+	Subject      pkix.Name
+	NotBefore    time.Time
+	NotAfter     time.Time
+
+	// PublicKey is *lms.PublicKey or *lms.HSSPublicKey for HSS/LMS keys,
+	// or any key supported by crypto/x509
+	PublicKey interface{}
+
+	KeyUsage stdx509.KeyUsage
+
+	BasicConstraintsValid bool
+	IsCA                  bool
+	MaxPathLen            int  // negative if unset
+	MaxPathLenZero        bool // MaxPathLen of 0 is explicitly set if true
+
+	SubjectKeyId   []byte
+	AuthorityKeyId []byte
+
+	Extensions      []pkix.Extension // all extensions of parsed certificates
+	ExtraExtensions []pkix.Extension // extensions added as they are by CreateCertificate
+
+	// UnhandledCriticalExtensions lists critical extensions unknown to
+	// the package, which fail verification
+	UnhandledCriticalExtensions []asn1.ObjectIdentifier
+}
+
+// certificate is the ASN.1 structure of Certificate
+type certificate struct {
+	TBSCertificate     asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+// tbsCertificate is the ASN.1 structure of TBSCertificate
+type tbsCertificate struct {
+	Raw                asn1.RawContent
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       *big.Int
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Issuer             asn1.RawValue
+	Validity           validity
+	Subject            asn1.RawValue
+	PublicKey          asn1.RawValue
+	UniqueID           asn1.BitString   `asn1:"optional,tag:1"`
+	SubjectUniqueID    asn1.BitString   `asn1:"optional,tag:2"`
+	Extensions         []pkix.Extension `asn1:"omitempty,optional,explicit,tag:3"`
+}
+
+type validity struct {
+	NotBefore, NotAfter time.Time
+}
+
+type basicConstraints struct {
+	IsCA       bool `asn1:"optional"`
+	MaxPathLen int  `asn1:"optional,default:-1"`
+}
+
+type authorityKeyID struct {
+	ID []byte `asn1:"optional,tag:0"`
+}
+
+// signatureAlgorithm identifies HSS/LMS signatures without parameters
+var signatureAlgorithm = pkix.AlgorithmIdentifier{Algorithm: lms.OIDHSSLMSHashSig}
+
+// CreateCertificate creates a DER-encoded certificate of the template
+// for the public key pub, which is signed by priv on behalf of parent.
+// priv shall be *lms.MerkleAgent or *lms.HSS, whose public key is that
+// of parent, and a leaf of priv is used up. Self-signed certificates
+// are made by passing the template as parent.
+//
+// The fields of the template in use are SerialNumber, Subject,
+// NotBefore, NotAfter, KeyUsage, BasicConstraintsValid, IsCA,
+// MaxPathLen, MaxPathLenZero, SubjectKeyId and ExtraExtensions, where
+// SubjectKeyId is derived from pub if absent. The issuer and authority
+// key identifier are taken from parent
+func CreateCertificate(template, parent *Certificate, pub, priv interface{}) ([]byte, error) {
+	if (nil == template.SerialNumber) || (template.SerialNumber.Sign() < 0) {
+		return nil, ErrMalformedCert
+	}
+
+	spki, err := marshalPublicKey(pub)
+	if nil != err {
+		return nil, err
+	}
+
+	issuerPub, err := signerPublicKey(priv)
+	if nil != err {
+		return nil, err
+	}
+
+	subject, err := asn1.Marshal(template.Subject.ToRDNSequence())
+	if nil != err {
+		return nil, err
+	}
+
+	issuer := subject
+	if parent != template {
+		if issuer, err = parentSubject(parent); nil != err {
+			return nil, err
+		}
+	}
+
+	subjectKeyID := template.SubjectKeyId
+	if 0 == len(subjectKeyID) {
+		subjectKeyID, err = keyID(spki)
+		if nil != err {
+			return nil, err
+		}
+	}
+
+	// the parent shall hold the public key of the signer
+	parentPub, authKeyID := parent.PublicKey, parent.SubjectKeyId
+	if parent == template {
+		parentPub, authKeyID = pub, subjectKeyID
+	}
+	if !samePublicKey(parentPub, issuerPub) {
+		return nil, ErrSignerMismatch
+	}
+
+	extensions, err := buildExtensions(template, subjectKeyID, authKeyID)
+	if nil != err {
+		return nil, err
+	}
+
+	tbs := tbsCertificate{
+		Version:            2,
+		SerialNumber:       template.SerialNumber,
+		SignatureAlgorithm: signatureAlgorithm,
+		Issuer:             asn1.RawValue{FullBytes: issuer},
+		Validity:           validity{template.NotBefore.UTC(), template.NotAfter.UTC()},
+		Subject:            asn1.RawValue{FullBytes: subject},
+		PublicKey:          asn1.RawValue{FullBytes: spki},
+		Extensions:         extensions,
+	}
+	tbsData, err := asn1.Marshal(tbs)
+	if nil != err {
+		return nil, err
+	}
+
+	sig, err := sign(priv, tbsData)
+	if nil != err {
+		return nil, err
+	}
+
+	if err := checkSignature(issuerPub, tbsData, sig); nil != err {
+		return nil, err
+	}
+
+	return asn1.Marshal(certificate{
+		TBSCertificate:     asn1.RawValue{FullBytes: tbsData},
+		SignatureAlgorithm: signatureAlgorithm,
+		SignatureValue:     asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)},
+	})
+}
+
+// ParseCertificate parses a DER-encoded certificate
+func ParseCertificate(der []byte) (*Certificate, error) {
+	cert := new(certificate)
+	rest, err := asn1.Unmarshal(der, cert)
+	if nil != err {
+		return nil, err
+	}
+	if 0 != len(rest) {
+		return nil, ErrMalformedCert
+	}
+
+	tbs := new(tbsCertificate)
+	if rest, err := asn1.Unmarshal(cert.TBSCertificate.FullBytes, tbs); nil != err {
+		return nil, err
+	} else if 0 != len(rest) {
+		return nil, ErrMalformedCert
+	}
+
+	if !cert.SignatureAlgorithm.Algorithm.Equal(lms.OIDHSSLMSHashSig) ||
+		(0 != len(cert.SignatureAlgorithm.Parameters.FullBytes)) {
+		return nil, ErrSignatureAlgorithm
+	}
+	if !tbs.SignatureAlgorithm.Algorithm.Equal(cert.SignatureAlgorithm.Algorithm) ||
+		!bytes.Equal(tbs.SignatureAlgorithm.Parameters.FullBytes, cert.SignatureAlgorithm.Parameters.FullBytes) {
+		return nil, ErrAlgorithmMismatch
+	}
+	if (0 != cert.SignatureValue.BitLength%8) || (nil == tbs.SerialNumber) {
+		return nil, ErrMalformedCert
+	}
+
+	c := &Certificate{
+		Raw:                     der,
+		RawTBSCertificate:       cert.TBSCertificate.FullBytes,
+		RawSubjectPublicKeyInfo: tbs.PublicKey.FullBytes,
+		RawSubject:              tbs.Subject.FullBytes,
+		RawIssuer:               tbs.Issuer.FullBytes,
+		Signature:               cert.SignatureValue.RightAlign(),
+		SerialNumber:            tbs.SerialNumber,
+		NotBefore:               tbs.Validity.NotBefore,
+		NotAfter:                tbs.Validity.NotAfter,
+		MaxPathLen:              -1,
+		Extensions:              tbs.Extensions,
+	}
+
+	for _, name := range []struct {
+		raw []byte
+		out *pkix.Name
+	}{{c.RawSubject, &c.Subject}, {c.RawIssuer, &c.Issuer}} {
+		var rdns pkix.RDNSequence
+		if rest, err := asn1.Unmarshal(name.raw, &rdns); nil != err {
+			return nil, err
+		} else if 0 != len(rest) {
+			return nil, ErrMalformedCert
+		}
+		name.out.FillFromRDNSequence(&rdns)
+	}
+
+	if c.PublicKey, err = parsePublicKey(c.RawSubjectPublicKeyInfo); nil != err {
+		return nil, err
+	}
+
+	if err := c.parseExtensions(); nil != err {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// EncodePEM encodes the DER-encoded certificate as a PEM block
+func EncodePEM(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypeCertificate, Bytes: der})
+}
+
+// ParseCertificatesPEM parses all the certificates in PEM blocks of
+// data, where blocks of other types are skipped
+func ParseCertificatesPEM(data []byte) ([]*Certificate, error) {
+	var certs []*Certificate
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); nil == block {
+			break
+		}
+		if pemTypeCertificate != block.Type {
+			continue
+		}
+
+		cert, err := ParseCertificate(block.Bytes)
+		if nil != err {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+// CheckSignature checks the HSS/LMS signature over signed by the
+// public key, which shall be *lms.PublicKey or *lms.HSSPublicKey
+func CheckSignature(pub interface{}, signed, signature []byte) error {
+	return checkSignature(pub, signed, signature)
+}
+
+// CheckSignatureFrom checks that the certificate is signed by the key
+// of parent, which shall be allowed to issue certificates
+func (c *Certificate) CheckSignatureFrom(parent *Certificate) error {
+	if !parent.BasicConstraintsValid || !parent.IsCA {
+		return ErrNotCA
+	}
+	if (0 != parent.KeyUsage) && (0 == parent.KeyUsage&stdx509.KeyUsageCertSign) {
+		return ErrKeyUsage
+	}
+
+	return checkSignature(parent.PublicKey, c.RawTBSCertificate, c.Signature)
+}
+
+// Equal checks if both certificates are of the same encoding
+func (c *Certificate) Equal(other *Certificate) bool {
+	if (nil == c) || (nil == other) {
+		return c == other
+	}
+
+	return bytes.Equal(c.Raw, other.Raw)
+}
+
+// parseExtensions fills the fields of the extensions handled by the
+// package, and records unknown critical ones
+func (c *Certificate) parseExtensions() error {
+	for _, ext := range c.Extensions {
+		var rest []byte
+		var err error
+
+		switch {
+		case ext.Id.Equal(oidExtensionBasicConstraints):
+			constraints := new(basicConstraints)
+			if rest, err = asn1.Unmarshal(ext.Value, constraints); nil == err {
+				c.BasicConstraintsValid = true
+				c.IsCA = constraints.IsCA
+				c.MaxPathLen = constraints.MaxPathLen
+				c.MaxPathLenZero = 0 == c.MaxPathLen
+			}
+		case ext.Id.Equal(oidExtensionKeyUsage):
+			var usage asn1.BitString
+			if rest, err = asn1.Unmarshal(ext.Value, &usage); nil == err {
+				for i := 0; i < 9; i++ {
+					if 0 != usage.At(i) {
+						c.KeyUsage |= 1 << uint(i)
+					}
+				}
+			}
+		case ext.Id.Equal(oidExtensionSubjectKeyID):
+			rest, err = asn1.Unmarshal(ext.Value, &c.SubjectKeyId)
+		case ext.Id.Equal(oidExtensionAuthorityKeyID):
+			akid := new(authorityKeyID)
+			if rest, err = asn1.Unmarshal(ext.Value, akid); nil == err {
+				c.AuthorityKeyId = akid.ID
+			}
+		default:
+			if ext.Critical {
+				c.UnhandledCriticalExtensions = append(c.UnhandledCriticalExtensions, ext.Id)
+			}
+		}
+
+		if nil != err {
+			return err
+		}
+		if 0 != len(rest) {
+			return ErrMalformedCert
+		}
+	}
+
+	return nil
+}
+
+// buildExtensions makes the extensions of the template, where basic
+// constraints and key usage are critical as RFC 5280 requires for CAs
+func buildExtensions(template *Certificate, subjectKeyID, authKeyID []byte) ([]pkix.Extension, error) {
+	var extensions []pkix.Extension
+
+	if template.BasicConstraintsValid {
+		maxPathLen := template.MaxPathLen
+		if (0 == maxPathLen) && !template.MaxPathLenZero {
+			maxPathLen = -1
+		}
+		value, err := asn1.Marshal(basicConstraints{template.IsCA, maxPathLen})
+		if nil != err {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionBasicConstraints, Critical: true, Value: value})
+	}
+
+	if 0 != template.KeyUsage {
+		var bits [2]byte
+		bitLength := 0
+		for i := 0; i < 9; i++ {
+			if 0 != template.KeyUsage&(1<<uint(i)) {
+				bits[i/8] |= 0x80 >> uint(i%8)
+				bitLength = i + 1
+			}
+		}
+		value, err := asn1.Marshal(asn1.BitString{Bytes: bits[:(bitLength+7)/8], BitLength: bitLength})
+		if nil != err {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionKeyUsage, Critical: true, Value: value})
+	}
+
+	if 0 != len(subjectKeyID) {
+		value, err := asn1.Marshal(subjectKeyID)
+		if nil != err {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionSubjectKeyID, Value: value})
+	}
+
+	if 0 != len(authKeyID) {
+		value, err := asn1.Marshal(authorityKeyID{authKeyID})
+		if nil != err {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionAuthorityKeyID, Value: value})
+	}
+
+	return append(extensions, template.ExtraExtensions...), nil
+}
+
+// parentSubject returns the DER-encoded subject of the parent
+func parentSubject(parent *Certificate) ([]byte, error) {
+	if 0 != len(parent.RawSubject) {
+		return parent.RawSubject, nil
+	}
+
+	return asn1.Marshal(parent.Subject.ToRDNSequence())
+}
+
+// keyID derives the key identifier as the SHA-1 digest of the subject
+// public key according to method 1 of RFC 5280 section 4.2.1.2
+func keyID(spki []byte) ([]byte, error) {
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(spki, &info); nil != err {
+		return nil, err
+	}
+
+	digest := sha1.Sum(info.PublicKey.Bytes)
+	return digest[:], nil
+}
+
+// marshalPublicKey encodes the public key as SubjectPublicKeyInfo by
+// lms for HSS/LMS keys, or crypto/x509 otherwise
+func marshalPublicKey(pub interface{}) ([]byte, error) {
+	switch pub.(type) {
+	case *lms.PublicKey, *lms.HSSPublicKey:
+		return lms.MarshalPKIXPublicKey(pub)
+	}
+
+	return stdx509.MarshalPKIXPublicKey(pub)
+}
+
+// parsePublicKey decodes the SubjectPublicKeyInfo by lms for HSS/LMS
+// keys, or crypto/x509 otherwise
+func parsePublicKey(spki []byte) (interface{}, error) {
+	pub, err := lms.ParsePKIXPublicKey(spki)
+	if lms.ErrUnsupportedAlgorithm != err {
+		return pub, err
+	}
+
+	return stdx509.ParsePKIXPublicKey(spki)
+}
+
+// signerPublicKey returns the public key of the signer
+func signerPublicKey(priv interface{}) (interface{}, error) {
+	switch signer := priv.(type) {
+	case *lms.MerkleAgent:
+		return signer.PublicKey(), nil
+	case *lms.HSS:
+		return signer.PublicKey(), nil
+	}
+
+	return nil, ErrUnsupportedSigner
+}
+
+// sign produces the HSS signature over the message encoded according
+// to RFC 8554, where LMS signatures go with no signed public keys
+func sign(priv interface{}, msg []byte) ([]byte, error) {
+	var hssSig *lms.HSSSig
+	switch signer := priv.(type) {
+	case *lms.MerkleAgent:
+		sig, err := lms.Sign(signer, msg)
+		if nil != err {
+			return nil, err
+		}
+		hssSig = &lms.HSSSig{Sig: sig}
+	case *lms.HSS:
+		sig, err := signer.Sign(msg)
+		if nil != err {
+			return nil, err
+		}
+		hssSig = sig
+	default:
+		return nil, ErrUnsupportedSigner
+	}
+
+	return hssSig.MarshalBinary()
+}
+
+// hssPublicKey converts the public key into a HSS one, where LMS keys
+// are of a single level
+func hssPublicKey(pub interface{}) (*lms.HSSPublicKey, error) {
+	switch pk := pub.(type) {
+	case *lms.PublicKey:
+		return &lms.HSSPublicKey{Levels: 1, PublicKey: pk}, nil
+	case *lms.HSSPublicKey:
+		return pk, nil
+	}
+
+	return nil, ErrUnsupportedKey
+}
+
+// samePublicKey checks if both HSS/LMS public keys are equal
+func samePublicKey(x, y interface{}) bool {
+	pkX, err := hssPublicKey(x)
+	if nil != err {
+		return false
+	}
+	pkY, err := hssPublicKey(y)
+	if nil != err {
+		return false
+	}
+
+	return (pkX.Levels == pkY.Levels) && pkX.PublicKey.Equal(pkY.PublicKey)
+}
+
+// checkSignature verifies the HSS signature encoded according to
+// RFC 8554 by HSSPublicKey.VerifyWithError
+func checkSignature(pub interface{}, signed, signature []byte) error {
+	pk, err := hssPublicKey(pub)
+	if nil != err {
+		return err
+	}
+
+	hssSig := new(lms.HSSSig)
+	if err := hssSig.UnmarshalBinary(signature); nil != err {
+		return err
+	}
+
+	return pk.VerifyWithError(signed, hssSig)
+}
@@ -0,0 +1,232 @@
+package x509
+
+import (
+	"crypto/rand"
+	stdx509 "crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/LoCCS/lmots"
+	"github.com/LoCCS/lms"
+)
+
+// testChain holds a root, intermediate and leaf generated locally,
+// where the root is a LMS tree and the intermediate a HSS
+type testChain struct {
+	rootAgent *lms.MerkleAgent
+	interHSS  *lms.HSS
+	leafAgent *lms.MerkleAgent
+
+	root, inter, leaf *Certificate
+}
+
+func newSeed(t *testing.T) []byte {
+	seed := make([]byte, lmots.N)
+	if _, err := rand.Read(seed); nil != err {
+		t.Fatal(err)
+	}
+
+	return seed
+}
+
+// newTemplate makes the template of a certificate valid for a day
+func newTemplate(serial int64, cn string, isCA bool) *Certificate {
+	template := &Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"LoCCS"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		KeyUsage:              stdx509.KeyUsageDigitalSignature,
+	}
+	if isCA {
+		template.KeyUsage |= stdx509.KeyUsageCertSign | stdx509.KeyUsageCRLSign
+	}
+
+	return template
+}
+
+func mustCreate(t *testing.T, template, parent *Certificate, pub, priv interface{}) *Certificate {
+	der, err := CreateCertificate(template, parent, pub, priv)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	cert, err := ParseCertificate(der)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func newTestChain(t *testing.T, rootTemplate *Certificate) *testChain {
+	tc := new(testChain)
+	var err error
+
+	if tc.rootAgent, err = lms.NewMerkleAgentWithTypecode(lms.LMS_SHA256_M32_H5, newSeed(t)); nil != err {
+		t.Fatal(err)
+	}
+	if tc.interHSS, err = lms.NewHSS([]uint32{2, 2}, newSeed(t)); nil != err {
+		t.Fatal(err)
+	}
+	if tc.leafAgent, err = lms.NewMerkleAgent(3, newSeed(t)); nil != err {
+		t.Fatal(err)
+	}
+
+	tc.root = mustCreate(t, rootTemplate, rootTemplate, tc.rootAgent.PublicKey(), tc.rootAgent)
+	tc.inter = mustCreate(t, newTemplate(2, "Intermediate CA", true), tc.root,
+		tc.interHSS.PublicKey(), tc.rootAgent)
+	tc.leaf = mustCreate(t, newTemplate(3, "Firmware", false), tc.inter,
+		tc.leafAgent.PublicKey(), tc.interHSS)
+
+	return tc
+}
+
+func TestCertificateChain(t *testing.T) {
+	tc := newTestChain(t, newTemplate(1, "Root CA", true))
+
+	if pk, ok := tc.leaf.PublicKey.(*lms.PublicKey); !ok || !pk.Equal(tc.leafAgent.PublicKey()) {
+		t.Fatalf("invalid leaf public key: %+v", tc.leaf.PublicKey)
+	}
+	if _, ok := tc.inter.PublicKey.(*lms.HSSPublicKey); !ok {
+		t.Fatalf("invalid type of intermediate public key: %T", tc.inter.PublicKey)
+	}
+	if ("Firmware" != tc.leaf.Subject.CommonName) || ("Intermediate CA" != tc.leaf.Issuer.CommonName) {
+		t.Fatalf("invalid names: %v, %v", tc.leaf.Subject, tc.leaf.Issuer)
+	}
+	if !tc.root.IsCA || (0 == tc.root.KeyUsage&stdx509.KeyUsageCertSign) || tc.leaf.IsCA {
+		t.Fatal("invalid basic constraints or key usage")
+	}
+	if string(tc.leaf.AuthorityKeyId) != string(tc.inter.SubjectKeyId) {
+		t.Fatal("authority key identifier of the leaf mismatches the intermediate")
+	}
+
+	chain, err := tc.leaf.Verify(VerifyOptions{
+		Roots:         []*Certificate{tc.root},
+		Intermediates: []*Certificate{tc.inter},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if (3 != len(chain)) || !chain[0].Equal(tc.leaf) || !chain[1].Equal(tc.inter) ||
+		!chain[2].Equal(tc.root) {
+		t.Fatalf("invalid chain of %d certificates", len(chain))
+	}
+
+	// the DER encoding is understood by crypto/x509 as well
+	stdLeaf, err := stdx509.ParseCertificate(tc.leaf.Raw)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if (0 != stdLeaf.SerialNumber.Cmp(tc.leaf.SerialNumber)) || (stdLeaf.Subject.CommonName != "Firmware") {
+		t.Fatalf("invalid certificate parsed by crypto/x509: %v", stdLeaf.Subject)
+	}
+
+	// the root is trusted by itself
+	if chain, err := tc.root.Verify(VerifyOptions{Roots: []*Certificate{tc.root}}); nil != err {
+		t.Fatal(err)
+	} else if 1 != len(chain) {
+		t.Fatalf("invalid chain of %d certificates", len(chain))
+	}
+}
+
+func TestCertificatePEM(t *testing.T) {
+	tc := newTestChain(t, newTemplate(1, "Root CA", true))
+
+	data := append(EncodePEM(tc.root.Raw), EncodePEM(tc.inter.Raw)...)
+	certs, err := ParseCertificatesPEM(data)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if (2 != len(certs)) || !certs[0].Equal(tc.root) || !certs[1].Equal(tc.inter) {
+		t.Fatalf("invalid certificates: %d", len(certs))
+	}
+}
+
+func TestCertificateVerifyFailures(t *testing.T) {
+	tc := newTestChain(t, newTemplate(1, "Root CA", true))
+	opts := VerifyOptions{
+		Roots:         []*Certificate{tc.root},
+		Intermediates: []*Certificate{tc.inter},
+	}
+
+	// expired
+	expired := opts
+	expired.CurrentTime = time.Now().Add(48 * time.Hour)
+	if _, err := tc.leaf.Verify(expired); ErrExpired != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrExpired, err)
+	}
+
+	// missing intermediate
+	if _, err := tc.leaf.Verify(VerifyOptions{Roots: opts.Roots}); ErrUnknownAuthority != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrUnknownAuthority, err)
+	}
+
+	// another root of the same name
+	other := newTestChain(t, newTemplate(1, "Root CA", true))
+	if _, err := tc.leaf.Verify(VerifyOptions{
+		Roots:         []*Certificate{other.root},
+		Intermediates: opts.Intermediates,
+	}); nil == err {
+		t.Fatal("chain to another root is accepted")
+	}
+
+	// tampered signature
+	tampered := *tc.leaf
+	tampered.Signature = append([]byte{}, tc.leaf.Signature...)
+	tampered.Signature[len(tampered.Signature)-1] ^= 1
+	if _, err := tampered.Verify(opts); lms.ErrRootMismatch != err {
+		t.Fatalf("invalid error: want %v, got %v", lms.ErrRootMismatch, err)
+	}
+
+	// leaves can't issue certificates
+	leafKey := tc.leafAgent.PublicKey()
+	grandchild := mustCreate(t, newTemplate(4, "Rogue", false), tc.leaf, leafKey, tc.leafAgent)
+	opts.Intermediates = append(opts.Intermediates, tc.leaf)
+	if _, err := grandchild.Verify(opts); ErrNotCA != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrNotCA, err)
+	}
+}
+
+func TestCertificatePathLength(t *testing.T) {
+	rootTemplate := newTemplate(1, "Root CA", true)
+	rootTemplate.MaxPathLenZero = true
+
+	tc := newTestChain(t, rootTemplate)
+	if !tc.root.MaxPathLenZero || (0 != tc.root.MaxPathLen) {
+		t.Fatalf("invalid path length constraint: %d", tc.root.MaxPathLen)
+	}
+
+	// the intermediate itself is allowed below the root
+	if _, err := tc.inter.Verify(VerifyOptions{Roots: []*Certificate{tc.root}}); nil != err {
+		t.Fatal(err)
+	}
+
+	_, err := tc.leaf.Verify(VerifyOptions{
+		Roots:         []*Certificate{tc.root},
+		Intermediates: []*Certificate{tc.inter},
+	})
+	if ErrPathLength != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrPathLength, err)
+	}
+}
+
+func TestCreateCertificateSignerMismatch(t *testing.T) {
+	tc := newTestChain(t, newTemplate(1, "Root CA", true))
+
+	// the intermediate can't sign on behalf of the root
+	_, err := CreateCertificate(newTemplate(5, "Firmware", false), tc.root,
+		tc.leafAgent.PublicKey(), tc.interHSS)
+	if ErrSignerMismatch != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrSignerMismatch, err)
+	}
+
+	if _, err := CreateCertificate(newTemplate(5, "Firmware", false), tc.root,
+		tc.leafAgent.PublicKey(), "not a signer"); ErrUnsupportedSigner != err {
+		t.Fatalf("invalid error: want %v, got %v", ErrUnsupportedSigner, err)
+	}
+}